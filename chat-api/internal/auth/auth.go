@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"chat-api/internal/config"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// minSecretLength меньше 256 бит для HS256 подбирается перебором
+const minSecretLength = 32
+
+type key struct {
+	method jwt.SigningMethod
+	sign   interface{} // nil если ключ только для проверки
+	verify interface{}
+}
+
+// Issuer подписывает и проверяет токены доступа, ключ выбирается по kid
+type Issuer struct {
+	keys      map[string]key
+	activeKID string
+	ttl       time.Duration
+}
+
+// NewIssuer собирает ключи из конфига, активный ключ должен уметь подписывать
+func NewIssuer(cfg *config.Config) (*Issuer, error) {
+	if len(cfg.JWTKeys) == 0 {
+		return nil, errors.New("no JWT keys configured, set JWT_SECRET or JWT_KEYS")
+	}
+
+	i := &Issuer{keys: make(map[string]key), activeKID: cfg.JWTActiveKID, ttl: cfg.TokenTTL}
+	for _, k := range cfg.JWTKeys {
+		if k.ID == "" {
+			return nil, errors.New("JWT key without kid")
+		}
+		if _, exists := i.keys[k.ID]; exists {
+			return nil, fmt.Errorf("duplicate JWT kid %q", k.ID)
+		}
+		parsed, err := parseKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %q: %v", k.ID, err)
+		}
+		i.keys[k.ID] = parsed
+	}
+
+	if i.activeKID == "" {
+		i.activeKID = cfg.JWTKeys[0].ID
+	}
+	active, ok := i.keys[i.activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active JWT kid %q not found", i.activeKID)
+	}
+	if active.sign == nil {
+		return nil, fmt.Errorf("active JWT kid %q cannot sign", i.activeKID)
+	}
+	return i, nil
+}
+
+func parseKey(k config.JWTKey) (key, error) {
+	switch k.Algorithm {
+	case "HS256":
+		if len(k.Secret) < minSecretLength {
+			return key{}, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		return key{method: jwt.SigningMethodHS256, sign: []byte(k.Secret), verify: []byte(k.Secret)}, nil
+	case "EdDSA":
+		seed, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return key{}, errors.New("secret must be a base64 ed25519 seed")
+		}
+		private := ed25519.NewKeyFromSeed(seed)
+		return key{method: jwt.SigningMethodEdDSA, sign: private, verify: private.Public()}, nil
+	case "EdDSA-public":
+		public, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return key{}, errors.New("secret must be a base64 ed25519 public key")
+		}
+		return key{method: jwt.SigningMethodEdDSA, verify: ed25519.PublicKey(public)}, nil
+	default:
+		return key{}, fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+	}
+}
+
+// Issue выдает токен для пользователя, ид лежит в sub
+func (i *Issuer) Issue(userID uint) (string, error) {
+	active := i.keys[i.activeKID]
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(i.ttl)),
+	}
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = i.activeKID
+	return token.SignedString(active.sign)
+}
+
+// Parse проверяет подпись и срок и возвращает ид пользователя
+func (i *Issuer) Parse(tokenString string) (uint, error) {
+	claims, err := i.parse(tokenString)
+	// у токенов доступа нет aud, токен загрузки не пускает в API
+	if err != nil || len(claims.Audience) > 0 {
+		return 0, ErrInvalidToken
+	}
+	return subjectID(claims)
+}
+
+// токен загрузки отличается от токена доступа полем aud
+const uploadAudience = "upload"
+
+// IssueUpload выдает короткоживущий токен на загрузку одного вложения, ид лежит в sub
+func (i *Issuer) IssueUpload(attachmentID uint, ttl time.Duration) (string, time.Time, error) {
+	active := i.keys[i.activeKID]
+	now := time.Now()
+	expires := now.Add(ttl)
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(attachmentID), 10),
+		Audience:  jwt.ClaimStrings{uploadAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expires),
+	}
+	token := jwt.NewWithClaims(active.method, claims)
+	token.Header["kid"] = i.activeKID
+	signed, err := token.SignedString(active.sign)
+	return signed, expires, err
+}
+
+// ParseUpload проверяет токен загрузки и возвращает ид вложения
+func (i *Issuer) ParseUpload(tokenString string) (uint, error) {
+	claims, err := i.parse(tokenString, jwt.WithAudience(uploadAudience))
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	return subjectID(claims)
+}
+
+func (i *Issuer) parse(tokenString string, opts ...jwt.ParserOption) (jwt.RegisteredClaims, error) {
+	var claims jwt.RegisteredClaims
+	opts = append(opts,
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithExpirationRequired())
+	_, err := jwt.ParseWithClaims(tokenString, &claims, i.keyFunc, opts...)
+	return claims, err
+}
+
+func subjectID(claims jwt.RegisteredClaims) (uint, error) {
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return 0, ErrInvalidToken
+	}
+	return uint(id), nil
+}
+
+func (i *Issuer) keyFunc(t *jwt.Token) (interface{}, error) {
+	// токены без kid выпущены до ротации, проверяем активным ключом
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		kid = i.activeKID
+	}
+	k, ok := i.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	// алгоритм из заголовка должен совпадать с ключом, иначе можно подменить HS256 на публичном ключе
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("algorithm %q does not match kid %q", t.Method.Alg(), kid)
+	}
+	return k.verify, nil
+}
+
+// BearerToken достает токен из заголовка Authorization
+func BearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(prefix):])
+}
+
+type contextKey struct{}
+
+// WithUserID кладет ид пользователя в контекст запроса
+func WithUserID(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, userID)
+}
+
+// UserID достает ид пользователя, положенный мидлваром
+func UserID(ctx context.Context) (uint, bool) {
+	userID, ok := ctx.Value(contextKey{}).(uint)
+	return userID, ok && userID != 0
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -11,17 +15,125 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	ServerPort string
+	// порт для /metrics, по умолчанию пусто и метрики не отдаются (но собираются). на публичном порту их нет
+	AdminPort string
+	// применять миграции при старте сервера, при нескольких репликах выключают
+	// и запускают chat-api migrate up отдельным шагом деплоя
+	AutoMigrate bool
+	// таймауты http сервера, потоки SSE снимают дедлайн записи сами
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// сколько ждать завершения запросов при остановке, потом соединения рвутся
+	ShutdownTimeout time.Duration
+	// ключи подписи токенов, JWTActiveKID - каким подписываем новые
+	JWTKeys      []JWTKey
+	JWTActiveKID string
+	TokenTTL     time.Duration
+	// свои эмодзи для реакций, используются как :name:
+	CustomEmojis []string
+	// redis для отметок "печатает" и "онлайн", пусто - хранить в памяти.
+	// онлайн продлевается пингами сокета раз в 54 секунды, OnlineTTL должен быть больше
+	RedisURL  string
+	TypingTTL time.Duration
+	OnlineTTL time.Duration
+	// где хранить вложения: local в каталоге BlobDir или s3
+	BlobStore   string
+	BlobDir     string
+	S3          S3Config
+	UploadLimit int64 // максимальный размер одного файла в байтах
+	PinLimit    int   // сколько сообщений можно закрепить в одном чате
+	// фоновая обработка картинок: размеры превью, опрос очереди и повторы
+	ThumbnailSizes []int
+	JobInterval    time.Duration
+	JobAttempts    int
+	JobBackoff     time.Duration
+	// уровень логов: debug, info, warn или error
+	LogLevel slog.Level
+}
+
+// S3Config доступ к S3 совместимому хранилищу, например MinIO
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+// JWTKey ключ из JWT_KEYS в формате kid:alg:secret
+// alg: HS256 (secret - строка), EdDSA (secret - base64 seed приватного ключа),
+// EdDSA-public (secret - base64 публичного ключа, только проверка старых токенов)
+type JWTKey struct {
+	ID        string
+	Algorithm string
+	Secret    string
 }
 
 func Load() *Config {
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "db"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "postgres"),
-		DBName:     getEnv("DB_NAME", "chatdb"),
-		ServerPort: getEnv("PORT", "8080"),
+		DBHost:          getEnv("DB_HOST", "db"),
+		DBPort:          getEnv("DB_PORT", "5432"),
+		DBUser:          getEnv("DB_USER", "postgres"),
+		DBPassword:      getEnv("DB_PASSWORD", "postgres"),
+		DBName:          getEnv("DB_NAME", "chatdb"),
+		ServerPort:      getEnv("PORT", "8080"),
+		AdminPort:       getEnv("ADMIN_PORT", ""),
+		AutoMigrate:     getEnv("AUTO_MIGRATE", "true") == "true",
+		ReadTimeout:     getEnvDuration("READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:    getEnvDuration("WRITE_TIMEOUT", 15*time.Second),
+		ShutdownTimeout: getEnvDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		JWTKeys:         getJWTKeys(),
+		JWTActiveKID:    getEnv("JWT_ACTIVE_KID", ""),
+		TokenTTL:        getEnvDuration("TOKEN_TTL", 24*time.Hour),
+		CustomEmojis:    getEnvList("CUSTOM_EMOJIS"),
+		RedisURL:        getEnv("REDIS_URL", ""),
+		TypingTTL:       getEnvDuration("TYPING_TTL", 6*time.Second),
+		OnlineTTL:       getEnvDuration("ONLINE_TTL", 90*time.Second),
+		BlobStore:       getEnv("BLOB_STORE", "local"),
+		BlobDir:         getEnv("BLOB_DIR", "./data/attachments"),
+		S3: S3Config{
+			Endpoint:  getEnv("S3_ENDPOINT", ""),
+			AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("S3_SECRET_KEY", ""),
+			Bucket:    getEnv("S3_BUCKET", ""),
+			Region:    getEnv("S3_REGION", ""),
+			UseSSL:    getEnv("S3_USE_SSL", "false") == "true",
+		},
+		UploadLimit:    getEnvInt64("UPLOAD_LIMIT", 25<<20),
+		PinLimit:       int(getEnvInt64("PIN_LIMIT", 50)),
+		ThumbnailSizes: getEnvIntList("THUMBNAIL_SIZES", []int{160, 320, 800}),
+		JobInterval:    getEnvDuration("JOB_INTERVAL", 2*time.Second),
+		JobAttempts:    int(getEnvInt64("JOB_ATTEMPTS", 5)),
+		JobBackoff:     getEnvDuration("JOB_BACKOFF", 10*time.Second),
+		LogLevel:       getEnvLevel("LOG_LEVEL", slog.LevelInfo),
+	}
+}
+
+// getJWTKeys читает JWT_KEYS через запятую, без него один HS256 ключ из JWT_SECRET.
+// ключа по умолчанию нет, без обоих переменных сервер не стартует
+func getJWTKeys() []JWTKey {
+	raw := getEnv("JWT_KEYS", "")
+	if strings.TrimSpace(raw) == "" {
+		if secret := getEnv("JWT_SECRET", ""); secret != "" {
+			return []JWTKey{{ID: "default", Algorithm: "HS256", Secret: secret}}
+		}
+		return nil
+	}
+
+	var keys []JWTKey
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+		keys = append(keys, JWTKey{ID: parts[0], Algorithm: parts[1], Secret: parts[2]})
 	}
+	return keys
 }
 
 func getEnv(key, defaultValue string) string {
@@ -31,7 +143,64 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList список через запятую, пустые элементы пропускаются
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvIntList числа через запятую, если ни одного не разобралось - значение по умолчанию
+func getEnvIntList(key string, defaultValue []int) []int {
+	var list []int
+	for _, item := range getEnvList(key) {
+		if n, err := strconv.Atoi(item); err == nil && n > 0 {
+			list = append(list, n)
+		}
+	}
+	if len(list) == 0 {
+		return defaultValue
+	}
+	return list
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, exists := os.LookupEnv(key); exists {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvLevel(key string, defaultValue slog.Level) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv(key, ""))); err != nil {
+		return defaultValue
+	}
+	return level
+}
+
 func (c *Config) GetDSN() string {
 	return "host=" + c.DBHost + " port=" + c.DBPort + " user=" + c.DBUser +
 		" password=" + c.DBPassword + " dbname=" + c.DBName + " sslmode=disable"
 }
+
+// RedactedDSN тот же DSN, но со скрытым паролем, для логов
+func (c *Config) RedactedDSN() string {
+	return "host=" + c.DBHost + " port=" + c.DBPort + " user=" + c.DBUser +
+		" password=*** dbname=" + c.DBName + " sslmode=disable"
+}
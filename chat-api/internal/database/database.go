@@ -3,9 +3,11 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -14,15 +16,17 @@ import (
 	"gorm.io/gorm"
 
 	"chat-api/internal/config"
+	"chat-api/migrations"
 )
 
 var DB *gorm.DB
 
-func InitDB(cfg *config.Config) (*gorm.DB, error) {
-	dsn := cfg.GetDSN()
-	log.Printf("Подключение к базе с DSN: %s", dsn)
+// Open подключается к базе и ждет пока она поднимется
+func Open(cfg *config.Config) (*sql.DB, error) {
+	// пароль в лог не попадает
+	slog.Info("Подключение к базе", "dsn", cfg.RedactedDSN())
 
-	sqlDB, err := sql.Open("pgx", dsn)
+	sqlDB, err := sql.Open("pgx", cfg.GetDSN())
 	if err != nil {
 		return nil, fmt.Errorf("Провал при соединении к бд: %v", err)
 	}
@@ -32,17 +36,30 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 		if err == nil {
 			break
 		}
-		log.Printf("Ожидание дб... (попытка %d/10): %v", i+1, err)
+		slog.Warn("Ожидание дб...", "attempt", i+1, "max_attempts", 10, "error", err)
 		time.Sleep(2 * time.Second)
 	}
 
 	if err != nil {
 		return nil, fmt.Errorf("Не вышло подключитсья к дб: %v", err)
 	}
+	return sqlDB, nil
+}
 
-	err = runGooseMigrations(sqlDB)
+func InitDB(cfg *config.Config) (*gorm.DB, error) {
+	sqlDB, err := Open(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("Не вышло совершить миграцию: %v", err)
+		return nil, err
+	}
+
+	// при нескольких репликах миграции лучше выключить и гонять отдельно через migrate up
+	if cfg.AutoMigrate {
+		err = runGooseMigrations(sqlDB)
+		if err != nil {
+			return nil, fmt.Errorf("Не вышло совершить миграцию: %v", err)
+		}
+	} else {
+		slog.Info("Автомиграция выключена (AUTO_MIGRATE=false)")
 	}
 
 	DB, err = gorm.Open(postgres.New(postgres.Config{
@@ -52,91 +69,93 @@ func InitDB(cfg *config.Config) (*gorm.DB, error) {
 		return nil, fmt.Errorf("Не вышло открыть бд: %v", err)
 	}
 
-	log.Println("База данных успешно подключена и  мигрирована")
+	slog.Info("База данных успешно подключена", "host", cfg.DBHost, "dbname", cfg.DBName)
 	return DB, nil
 }
 
-func runGooseMigrations(db *sql.DB) error {
-	migrationDir := "./migrations"
-
-	// Создаем папку migrations если ее нет
-	if _, err := os.Stat(migrationDir); os.IsNotExist(err) {
-		log.Printf("Создание директории дял мигарции(если  нет): %s", migrationDir)
-		err := os.MkdirAll(migrationDir, 0755)
-		if err != nil {
-			return fmt.Errorf("Ошибка создания директории для   миграции: %v", err)
-		}
-		err = createInitialMigration(migrationDir)
-		if err != nil {
-			return fmt.Errorf("Не получилось инициировать первую мигарцию: %v", err)
-		}
-	}
-
-	//goose настройка
-	goose.SetBaseFS(nil) // нил потому что нужен дефолт
+// setupGoose goose читает миграции из зашитых в бинарник файлов
+func setupGoose() {
+	goose.SetBaseFS(migrations.FS)
 	goose.SetTableName("goose_migrations")
+}
+
+func runGooseMigrations(db *sql.DB) error {
+	setupGoose()
 
 	//получение версии миграции
 	currentVersion, err := goose.GetDBVersion(db)
 	if err != nil {
-		log.Printf("Получение версии миграции: %v", err)
+		slog.Warn("Получение версии миграции", "error", err)
 	} else {
-		log.Printf("Текущая версия миграции: %d", currentVersion)
+		slog.Info("Текущая версия миграции", "version", currentVersion)
 	}
 
 	//применяем миграции вверх
-	err = goose.Up(db, migrationDir)
+	err = goose.Up(db, ".")
 	if err != nil {
 		return fmt.Errorf("Не вышло применить goose migrations: %v", err)
 	}
 
 	//статус после миграций
-	err = goose.Status(db, migrationDir)
+	err = goose.Status(db, ".")
 	if err != nil {
-		log.Printf("Не выходит получить статус: %v", err)
+		slog.Warn("Не выходит получить статус", "error", err)
 	}
-	log.Println("Статус миграции получен успешно")
+	slog.Info("Статус миграции получен успешно")
 	return nil
 }
 
-func createInitialMigration(migrationDir string) error {
-	//сооздаем файл первой миграции
-	migrationFile := filepath.Join(migrationDir, "001_init.sql")
-
-	migrationContent := `-- +goose Up
-Создание таблицы чатов
-CREATE TABLE chats (
-    id SERIAL PRIMARY KEY,
-    title VARCHAR(200) NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
-
-Создание таблицы сообщений
-CREATE TABLE messages (
-    id SERIAL PRIMARY KEY,
-    chat_id INTEGER NOT NULL,
-    text VARCHAR(5000) NOT NULL,
-    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    CONSTRAINT fk_chat FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE
-);
-
-Создание индексов для оптимизации
-CREATE INDEX idx_messages_chat_id ON messages(chat_id);
-CREATE INDEX idx_messages_created_at ON messages(created_at DESC);
-
--- +goose Down
--- Удаление таблиц в обратном порядке
-DROP INDEX IF EXISTS idx_messages_created_at;
-DROP INDEX IF EXISTS idx_messages_chat_id;
-DROP TABLE IF EXISTS messages;
-DROP TABLE IF EXISTS chats;
-`
-
-	err := os.WriteFile(migrationFile, []byte(migrationContent), 0644)
+// Migrate выполняет команду goose над зашитыми миграциями: up, down, status или redo
+func Migrate(db *sql.DB, command string) error {
+	setupGoose()
+
+	switch command {
+	case "up":
+		return goose.Up(db, ".")
+	case "down":
+		return goose.Down(db, ".")
+	case "status":
+		return goose.Status(db, ".")
+	case "redo":
+		return goose.Redo(db, ".")
+	}
+	return fmt.Errorf("unknown migrate command %q", command)
+}
+
+var (
+	migrationFile = regexp.MustCompile(`^(\d+)_.*\.sql$`)
+	migrationName = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// CreateMigration создает пустую миграцию в папке с исходниками миграций dir
+// со следующим номером, имя в том же формате NNN_name.sql. в бинарник она попадет после сборки
+func CreateMigration(dir, name string) (string, error) {
+	if !migrationName.MatchString(name) {
+		return "", fmt.Errorf("migration name must be snake_case: %q", name)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
 	if err != nil {
-		return fmt.Errorf("Не вышло создать миграционный файл: %v", err)
+		return "", err
+	}
+	last := 0
+	for _, file := range files {
+		match := migrationFile.FindStringSubmatch(filepath.Base(file))
+		if match == nil {
+			continue
+		}
+		if version, _ := strconv.Atoi(match[1]); version > last {
+			last = version
+		}
 	}
 
-	log.Printf("Создан файл первичной миграции: %s", migrationFile)
-	return nil
+	path := filepath.Join(dir, fmt.Sprintf("%03d_%s.sql", last+1, name))
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("migration %s already exists", path)
+	}
+	content := "-- +goose Up\n\n-- +goose Down\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("Не вышло создать миграционный файл: %v", err)
+	}
+	return path, nil
 }
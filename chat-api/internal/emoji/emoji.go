@@ -0,0 +1,131 @@
+package emoji
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	zwj               = 0x200D
+	variationSelector = 0xFE0F // эмодзи-представление
+	keycapMark        = 0x20E3
+	tagCancel         = 0xE007F
+	blackFlag         = 0x1F3F4
+)
+
+// MaxLength ограничение на длину реакции в байтах, хватает на самые длинные ZWJ последовательности
+const MaxLength = 64
+
+// диапазоны пиктограмм, приближение Extended_Pictographic из Unicode,
+// в стандартной библиотеке таблиц эмодзи нет
+var pictographic = [][2]rune{
+	{0x00A9, 0x00A9}, {0x00AE, 0x00AE}, {0x203C, 0x203C}, {0x2049, 0x2049},
+	{0x2122, 0x2122}, {0x2139, 0x2139}, {0x2194, 0x2199}, {0x21A9, 0x21AA},
+	{0x231A, 0x231B}, {0x2328, 0x2328}, {0x2388, 0x2388}, {0x23CF, 0x23CF},
+	{0x23E9, 0x23F3}, {0x23F8, 0x23FA}, {0x24C2, 0x24C2}, {0x25AA, 0x25AB},
+	{0x25B6, 0x25B6}, {0x25C0, 0x25C0}, {0x25FB, 0x25FE}, {0x2600, 0x27BF},
+	{0x2934, 0x2935}, {0x2B05, 0x2B07}, {0x2B1B, 0x2B1C}, {0x2B50, 0x2B50},
+	{0x2B55, 0x2B55}, {0x3030, 0x3030}, {0x303D, 0x303D}, {0x3297, 0x3297},
+	{0x3299, 0x3299}, {0x1F000, 0x1F1E5}, {0x1F200, 0x1F3FA}, {0x1F400, 0x1FAFF},
+	{0x1FC00, 0x1FFFD},
+}
+
+func isPictographic(r rune) bool {
+	for _, rng := range pictographic {
+		if r >= rng[0] && r <= rng[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool { return r >= 0x1F1E6 && r <= 0x1F1FF }
+func isSkinTone(r rune) bool          { return r >= 0x1F3FB && r <= 0x1F3FF }
+func isTag(r rune) bool               { return r >= 0xE0020 && r <= 0xE007E }
+func isKeycapBase(r rune) bool        { return r == '#' || r == '*' || (r >= '0' && r <= '9') }
+
+// Valid проверяет что строка это ровно одно эмодзи: одиночный символ,
+// флаг из двух региональных индикаторов, keycap, тег-последовательность
+// (флаги регионов) или ZWJ последовательность с модификаторами тона кожи
+func Valid(s string) bool {
+	if s == "" || len(s) > MaxLength {
+		return false
+	}
+	runes := []rune(s)
+
+	// флаг страны
+	if isRegionalIndicator(runes[0]) {
+		return len(runes) == 2 && isRegionalIndicator(runes[1])
+	}
+
+	// 1️⃣ #️⃣
+	if isKeycapBase(runes[0]) {
+		if len(runes) == 3 {
+			return runes[1] == variationSelector && runes[2] == keycapMark
+		}
+		return len(runes) == 2 && runes[1] == keycapMark
+	}
+
+	// флаги регионов: черный флаг, теги и завершающий cancel tag
+	if runes[0] == blackFlag && len(runes) > 2 && isTag(runes[1]) {
+		for _, r := range runes[1 : len(runes)-1] {
+			if !isTag(r) {
+				return false
+			}
+		}
+		return runes[len(runes)-1] == tagCancel
+	}
+
+	// ZWJ последовательность из одного и более элементов
+	start := 0
+	for i := 0; i <= len(runes); i++ {
+		if i == len(runes) || runes[i] == zwj {
+			if !validElement(runes[start:i]) {
+				return false
+			}
+			start = i + 1
+		}
+	}
+	return true
+}
+
+// validElement пиктограмма с необязательным FE0F и необязательным тоном кожи
+func validElement(runes []rune) bool {
+	if len(runes) == 0 || !isPictographic(runes[0]) {
+		return false
+	}
+	rest := runes[1:]
+	if len(rest) > 0 && rest[0] == variationSelector {
+		rest = rest[1:]
+	}
+	if len(rest) > 0 && isSkinTone(rest[0]) {
+		rest = rest[1:]
+	}
+	return len(rest) == 0
+}
+
+var customName = regexp.MustCompile(`^[a-z0-9_+-]{1,32}$`)
+
+// Registry проверяет реакции: юникод эмодзи и, если заданы, свои эмодзи вида :name:
+type Registry struct {
+	custom map[string]bool
+}
+
+// NewRegistry принимает имена своих эмодзи без двоеточий, неподходящие имена пропускаются
+func NewRegistry(custom []string) *Registry {
+	r := &Registry{custom: make(map[string]bool)}
+	for _, name := range custom {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if customName.MatchString(name) {
+			r.custom[name] = true
+		}
+	}
+	return r
+}
+
+func (r *Registry) Valid(s string) bool {
+	if r != nil && len(s) > 2 && strings.HasPrefix(s, ":") && strings.HasSuffix(s, ":") {
+		return r.custom[s[1:len(s)-1]]
+	}
+	return Valid(s)
+}
@@ -0,0 +1,518 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/storage"
+	"chat-api/internal/store"
+)
+
+const (
+	// сколько файлов можно приложить к одному сообщению
+	maxMessageAttachments = 10
+	// сколько живет токен загрузки
+	uploadTokenTTL = 15 * time.Minute
+	// через сколько незагруженная резервация удаляется, с запасом на загрузку,
+	// начатую в последний момент жизни токена
+	pendingAttachmentTTL = time.Hour
+	// часть multipart формы в памяти, остальное во временных файлах
+	multipartMemory = 8 << 20
+)
+
+var (
+	errAttachmentUnavailable = problem.New(http.StatusBadRequest, problem.AttachmentUnavailable, "Attachment not found or already used")
+	errAlreadyUploaded       = problem.New(http.StatusConflict, problem.AlreadyUploaded, "Attachment already uploaded")
+	errInvalidMultipart      = problem.New(http.StatusBadRequest, problem.InvalidBody, "Invalid multipart body")
+	errStoreAttachment       = problem.New(http.StatusInternalServerError, problem.Internal, "Failed to store attachment")
+)
+
+// CreateAttachment резервирует вложение и выдает токен, по которому клиент
+// загружает файл через PUT /uploads/{token}, а потом передает ид в attachment_ids
+func (h *Handler) CreateAttachment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	var request struct {
+		Filename string `json:"filename"`
+		MimeType string `json:"mime_type"`
+		Size     int64  `json:"size"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+	mimeType, ok := validateMimeType(request.MimeType)
+	if !ok {
+		problem.Invalid(w, r, problem.FieldError{Field: "mime_type", Code: problem.FieldInvalid, Message: "Invalid mime type"})
+		return
+	}
+	if request.Size <= 0 {
+		problem.Invalid(w, r, problem.FieldError{Field: "size", Code: problem.FieldInvalid, Message: "Size must be positive"})
+		return
+	}
+	if request.Size > h.UploadLimit {
+		problem.Write(w, r, http.StatusRequestEntityTooLarge, problem.FileTooLarge, "File is too large")
+		return
+	}
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	// файлы нужны только для сообщений, поэтому и загружают их те, кто может писать
+	if _, ok := h.requirePublisher(w, r, chat, userID); !ok {
+		return
+	}
+
+	now := time.Now()
+	expires := now.Add(pendingAttachmentTTL)
+	attachment := models.Attachment{
+		ChatID:     chat.ID,
+		UploaderID: &userID,
+		Filename:   cleanFilename(request.Filename),
+		MimeType:   mimeType,
+		Size:       request.Size,
+		CreatedAt:  now,
+		ExpiresAt:  &expires,
+	}
+	if err := h.Attachments.CreateAttachment(r.Context(), &attachment); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to create attachment")
+		return
+	}
+
+	token, expires, err := h.Auth.IssueUpload(attachment.ID, uploadTokenTTL)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to create attachment")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Attachment  models.Attachment `json:"attachment"`
+		UploadURL   string            `json:"upload_url"`
+		UploadToken string            `json:"upload_token"`
+		ExpiresAt   time.Time         `json:"expires_at"`
+	}{
+		Attachment:  attachment,
+		UploadURL:   "/uploads/" + token,
+		UploadToken: token,
+		ExpiresAt:   expires,
+	})
+}
+
+// UploadAttachment принимает содержимое по токену загрузки, сам токен и есть авторизация.
+// тело должно быть ровно заявленного размера, загрузить можно один раз
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID, err := h.Auth.ParseUpload(mux.Vars(r)["token"])
+	if err != nil {
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidUploadToken, "Invalid or expired upload token")
+		return
+	}
+
+	attachment, err := h.Attachments.Attachment(r.Context(), attachmentID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.AttachmentNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load attachment")
+		return
+	}
+	if attachment.UploadedAt != nil {
+		problem.Write(w, r, http.StatusConflict, problem.AlreadyUploaded, "Attachment already uploaded")
+		return
+	}
+	if r.ContentLength != attachment.Size {
+		problem.Write(w, r, http.StatusBadRequest, problem.SizeMismatch, "Content-Length must match declared size")
+		return
+	}
+
+	key, err := newBlobKey(attachment.ChatID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to store attachment")
+		return
+	}
+	// ключ записывается до начала загрузки: если она оборвется, воркер удалит
+	// просроченную резервацию вместе с недописанным файлом
+	err = h.Attachments.BeginUpload(r.Context(), attachment.ID, key)
+	if errors.Is(err, store.ErrConflict) {
+		err = errAlreadyUploaded
+	}
+	if err != nil {
+		problem.Send(w, r, problem.From(err, "Failed to store attachment"))
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, attachment.Size)
+	if err := h.storeBlob(r.Context(), attachment, key, body); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.SizeMismatch, "Failed to store attachment")
+		return
+	}
+
+	// две параллельные загрузки по одному токену: выигрывает первая,
+	// превью картинок строятся в фоне и ответ их не ждет
+	err = h.Attachments.CompleteUpload(r.Context(), attachment)
+	if errors.Is(err, store.ErrConflict) {
+		err = errAlreadyUploaded
+	}
+	if err != nil {
+		h.deleteBlobs(r.Context(), attachment.StorageKey)
+		problem.Send(w, r, problem.From(err, "Failed to store attachment"))
+		return
+	}
+
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// GetAttachment отдает файл участникам чата, поддерживает Range запросы.
+// файл еще не отправленного сообщения видит только загрузивший
+func (h *Handler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := h.readableAttachment(w, r)
+	if !ok {
+		return
+	}
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+	h.serveBlob(w, r, attachment.StorageKey, attachment.MimeType, disposition, attachment.SHA256, attachment.CreatedAt)
+}
+
+// GetThumbnail отдает превью картинки тем же, кому доступен сам файл.
+// пока фоновая обработка не закончилась, превью нет и ответ 404
+func (h *Handler) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.Atoi(mux.Vars(r)["size"])
+	if err != nil {
+		problem.Invalid(w, r, problem.FieldError{Field: "size", Code: problem.FieldInvalid, Message: "Invalid thumbnail size"})
+		return
+	}
+	attachment, ok := h.readableAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	thumbnail, err := h.Attachments.Thumbnail(r.Context(), attachment.ID, size)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.ThumbnailNotFound, "Thumbnail not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load thumbnail")
+		return
+	}
+	// превью строится заново только после смены исходника, так что его хеш годится в ETag
+	etag := fmt.Sprintf("%s-%d", attachment.SHA256, thumbnail.Size)
+	h.serveBlob(w, r, thumbnail.StorageKey, thumbnail.MimeType, "inline", etag, attachment.CreatedAt)
+}
+
+// readableAttachment находит загруженное вложение из {id} и проверяет доступ, при отказе сам пишет ответ
+func (h *Handler) readableAttachment(w http.ResponseWriter, r *http.Request) (*models.Attachment, bool) {
+	vars := mux.Vars(r)
+	attachmentID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid attachment ID")
+		return nil, false
+	}
+	userID, _ := h.currentUserID(r)
+
+	// пока файл не загружен, его для всех нет
+	attachment, err := h.Attachments.Attachment(r.Context(), uint(attachmentID))
+	if errors.Is(err, store.ErrNotFound) || (err == nil && attachment.UploadedAt == nil) {
+		problem.Write(w, r, http.StatusNotFound, problem.AttachmentNotFound, "Attachment not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load attachment")
+		return nil, false
+	}
+	if _, ok := h.requireMember(w, r, attachment.ChatID, userID); !ok {
+		return nil, false
+	}
+	if attachment.MessageID == nil {
+		if attachment.UploaderID == nil || *attachment.UploaderID != userID {
+			problem.Write(w, r, http.StatusNotFound, problem.AttachmentNotFound, "Attachment not found")
+			return nil, false
+		}
+	} else if _, err := h.Messages.Message(r.Context(), attachment.ChatID, *attachment.MessageID, false); err != nil {
+		// у удаленного сообщения вложения тоже скрыты
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, problem.AttachmentNotFound, "Attachment not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load attachment")
+		}
+		return nil, false
+	}
+	return attachment, true
+}
+
+// serveBlob отдает содержимое из хранилища с поддержкой Range и условных запросов
+func (h *Handler) serveBlob(w http.ResponseWriter, r *http.Request, key, contentType, disposition, etag string, modified time.Time) {
+	blob, err := h.Blobs.Open(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, problem.AttachmentNotFound, "Attachment not found")
+		} else {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to open attachment")
+		}
+		return
+	}
+	defer blob.Close()
+
+	// большой файл не уложится в WRITE_TIMEOUT сервера
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("ETag", `"`+etag+`"`)
+	http.ServeContent(w, r, "", modified, blob)
+}
+
+// newBlobKey новый ключ файла в хранилище, у каждой загрузки свой
+func newBlobKey(chatID uint) (string, error) {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("chats/%d/%s", chatID, hex.EncodeToString(suffix)), nil
+}
+
+// storeBlob кладет содержимое в хранилище под ключом key, считает sha256
+// и проверяет что пришло ровно attachment.Size байт. строку в базе не трогает
+func (h *Handler) storeBlob(ctx context.Context, attachment *models.Attachment, key string, body io.Reader) error {
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(body, hash)}
+	if err := h.Blobs.Put(ctx, key, counter, attachment.Size, attachment.MimeType); err != nil {
+		h.deleteBlobs(ctx, key)
+		return err
+	}
+	// лишние байты сверх заявленного размера тоже ошибка
+	if counter.n != attachment.Size || !atEOF(body) {
+		h.deleteBlobs(ctx, key)
+		return io.ErrUnexpectedEOF
+	}
+
+	now := time.Now()
+	attachment.StorageKey = key
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	attachment.UploadedAt = &now
+	return nil
+}
+
+// readMultipartMessage разбирает multipart/form-data: поля text и parent_id
+// и файлы в поле file. файлы сразу сохраняются и возвращаются еще без сообщения
+func (h *Handler) readMultipartMessage(w http.ResponseWriter, r *http.Request, chatID, userID uint) (*messageRequest, []models.Attachment, *problem.Problem) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMessageAttachments*h.UploadLimit+multipartMemory)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		return nil, nil, errInvalidMultipart
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	request := &messageRequest{Text: r.FormValue("text")}
+	if parent := r.FormValue("parent_id"); parent != "" {
+		id, err := strconv.ParseUint(parent, 10, 64)
+		if err != nil {
+			return nil, nil, &problem.Problem{
+				Status: http.StatusBadRequest,
+				Code:   problem.ValidationFailed,
+				Detail: "Invalid parent ID",
+				Errors: []problem.FieldError{{Field: "parent_id", Code: problem.FieldInvalid, Message: "Invalid parent ID"}},
+			}
+		}
+		parentID := uint(id)
+		request.ParentID = &parentID
+	}
+
+	files := r.MultipartForm.File["file"]
+	if len(files) > maxMessageAttachments {
+		detail := fmt.Sprintf("At most %d attachments per message", maxMessageAttachments)
+		return nil, nil, &problem.Problem{
+			Status: http.StatusBadRequest,
+			Code:   problem.ValidationFailed,
+			Detail: detail,
+			Errors: []problem.FieldError{{Field: "file", Code: problem.FieldTooMany, Message: detail}},
+		}
+	}
+
+	var attachments []models.Attachment
+	fail := func(p *problem.Problem) (*messageRequest, []models.Attachment, *problem.Problem) {
+		h.deleteAttachments(r.Context(), attachments)
+		return nil, nil, p
+	}
+	for _, file := range files {
+		if file.Size > h.UploadLimit {
+			return fail(problem.New(http.StatusRequestEntityTooLarge, problem.FileTooLarge, "File is too large"))
+		}
+		mimeType, ok := validateMimeType(file.Header.Get("Content-Type"))
+		if !ok {
+			return fail(&problem.Problem{
+				Status: http.StatusBadRequest,
+				Code:   problem.ValidationFailed,
+				Detail: "Invalid mime type",
+				Errors: []problem.FieldError{{Field: "file", Code: problem.FieldInvalid, Message: "Invalid mime type"}},
+			})
+		}
+
+		attachment := models.Attachment{
+			ChatID:     chatID,
+			UploaderID: &userID,
+			Filename:   cleanFilename(file.Filename),
+			MimeType:   mimeType,
+			Size:       file.Size,
+			CreatedAt:  time.Now(),
+		}
+		key, err := newBlobKey(chatID)
+		if err != nil {
+			return fail(errStoreAttachment)
+		}
+		f, err := file.Open()
+		if err != nil {
+			return fail(errInvalidMultipart)
+		}
+		err = h.storeBlob(r.Context(), &attachment, key, f)
+		f.Close()
+		if err != nil {
+			return fail(errStoreAttachment)
+		}
+		// файл уже загружен, так что сразу попадает и в очередь обработки
+		if err := h.Attachments.CreateAttachment(r.Context(), &attachment); err != nil {
+			h.deleteBlobs(r.Context(), attachment.StorageKey)
+			return fail(errStoreAttachment)
+		}
+		attachments = append(attachments, attachment)
+		request.AttachmentIDs = append(request.AttachmentIDs, attachment.ID)
+	}
+	return request, attachments, nil
+}
+
+// countUnique сколько разных ид в списке
+func countUnique(ids []uint) int {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return len(unique)
+}
+
+// attachFiles подтягивает вложения живых сообщений одним запросом
+func (h *Handler) attachFiles(ctx context.Context, messages []models.Message) error {
+	var ids []uint
+	for _, m := range messages {
+		if !m.DeletedAt.Valid {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	attachments, err := h.Attachments.MessageAttachments(ctx, ids)
+	if err != nil {
+		return err
+	}
+	byMessage := make(map[uint][]models.Attachment)
+	for _, a := range attachments {
+		byMessage[*a.MessageID] = append(byMessage[*a.MessageID], a)
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// deleteAttachments убирает вложения, так и не попавшие в сообщение
+func (h *Handler) deleteAttachments(ctx context.Context, attachments []models.Attachment) {
+	keys := make([]string, 0, len(attachments))
+	for _, a := range attachments {
+		if err := h.Attachments.DeleteAttachment(context.WithoutCancel(ctx), a.ID); err != nil {
+			h.logger(ctx).Warn("attachment cleanup failed", "attachment_id", a.ID, "error", err)
+		}
+		keys = append(keys, a.StorageKey)
+	}
+	h.deleteBlobs(ctx, keys...)
+}
+
+// deleteBlobs удаляет содержимое после того как строки уже удалены, ошибки только в лог:
+// осиротевший файл хуже не сделает, а запрос уже выполнен. отмена ctx удаление не прерывает
+func (h *Handler) deleteBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := h.Blobs.Delete(context.WithoutCancel(ctx), key); err != nil {
+			h.logger(ctx).Warn("blob cleanup failed", "key", key, "error", err)
+		}
+	}
+}
+
+// validateMimeType пустой тип считается двоичным файлом
+func validateMimeType(value string) (string, bool) {
+	if strings.TrimSpace(value) == "" {
+		return "application/octet-stream", true
+	}
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "", false
+	}
+	return mime.FormatMediaType(mediaType, params), true
+}
+
+// cleanFilename оставляет только имя файла без пути и управляющих символов
+func cleanFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// atEOF true если в r больше ничего нет
+func atEOF(r io.Reader) bool {
+	var b [1]byte
+	n, _ := r.Read(b[:])
+	return n == 0
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"chat-api/internal/auth"
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+// буквы, цифры и _.- чтобы имя можно было упомянуть через @
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,50}$`)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var request credentials
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	username := strings.TrimSpace(request.Username)
+	if !usernamePattern.MatchString(username) {
+		problem.Invalid(w, r, problem.FieldError{Field: "username", Code: problem.FieldFormat, Message: "Username must be 3 to 50 letters, digits, '_', '.' or '-'"})
+		return
+	}
+	// bcrypt не принимает пароли длиннее 72 байт
+	if len(request.Password) < 8 || len(request.Password) > 72 {
+		problem.Invalid(w, r, problem.FieldError{Field: "password", Code: problem.FieldLength, Message: "Password must be between 8 and 72 characters"})
+		return
+	}
+
+	hash, err := auth.HashPassword(request.Password)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to create user")
+		return
+	}
+
+	user := models.User{
+		Username:     username,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	err = h.Users.CreateUser(r.Context(), &user)
+	if errors.Is(err, store.ErrConflict) {
+		problem.Write(w, r, http.StatusConflict, problem.UsernameTaken, "Username already taken")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to create user")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var request credentials
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	user, err := h.Users.UserByName(r.Context(), strings.TrimSpace(request.Username))
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidCredentials, "Invalid username or password")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load user")
+		return
+	}
+	if !auth.CheckPassword(user.PasswordHash, request.Password) {
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidCredentials, "Invalid username or password")
+		return
+	}
+
+	token, err := h.Auth.Issue(user.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to issue token")
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}{
+		Token: token,
+		User:  *user,
+	})
+}
+
+// currentUserID возвращает ид пользователя, положенный мидлваром Auth
+func (h *Handler) currentUserID(r *http.Request) (uint, bool) {
+	return auth.UserID(r.Context())
+}
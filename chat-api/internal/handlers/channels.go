@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+var (
+	errNotPublisher = problem.New(http.StatusForbidden, problem.NotPublisher, "Only channel owner or admins can post")
+	errNotMember    = problem.New(http.StatusForbidden, problem.NotMember, "Not a chat member")
+)
+
+// canPublish может ли участник писать в чат: в канале только владелец и админы
+func canPublish(chat *models.Chat, member *models.ChatMember) bool {
+	return chat.Type != models.ChatChannel || member.Role == models.RoleOwner || member.Role == models.RoleAdmin
+}
+
+// requirePublisher как requireMember, но подписчикам канала отказывает
+func (h *Handler) requirePublisher(w http.ResponseWriter, r *http.Request, chat *models.Chat, userID uint) (*models.ChatMember, bool) {
+	member, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return nil, false
+	}
+	if !canPublish(chat, member) {
+		problem.Send(w, r, errNotPublisher)
+		return nil, false
+	}
+	return member, true
+}
+
+// channel загружает канал из {id}, при ошибке сам пишет ответ
+func (h *Handler) channel(w http.ResponseWriter, r *http.Request) (*models.Chat, bool) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return nil, false
+	}
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return nil, false
+	}
+	if chat.Type != models.ChatChannel {
+		problem.Write(w, r, http.StatusBadRequest, problem.NotChannel, "Chat is not a channel")
+		return nil, false
+	}
+	return chat, true
+}
+
+// Subscribe подписывает текущего пользователя на канал, подписаться может любой.
+// 201 если подписка новая, 200 если уже был подписан
+func (h *Handler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	chat, ok := h.channel(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	err := h.Chats.AddMember(r.Context(), &models.ChatMember{
+		ChatID:    chat.ID,
+		UserID:    userID,
+		Role:      models.RoleMember,
+		CreatedAt: time.Now(),
+	})
+	created := err == nil
+	if errors.Is(err, store.ErrConflict) {
+		err = nil
+	}
+	// счетчик подписчиков поменялся, отдаем чат заново
+	if err == nil {
+		chat, err = h.Chats.Chat(r.Context(), chat.ID)
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to subscribe")
+		return
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(chat)
+}
+
+// Unsubscribe отписывает текущего пользователя, владелец из своего канала не уходит
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	chat, ok := h.channel(w, r)
+	if !ok {
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	member, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return
+	}
+	if member.Role == models.RoleOwner {
+		problem.Write(w, r, http.StatusForbidden, problem.OwnerCannotBeRemoved, "Owner cannot be removed")
+		return
+	}
+
+	if err := h.removeMember(r.Context(), chat.ID, userID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to unsubscribe")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
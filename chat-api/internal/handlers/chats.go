@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+// длина превью последнего сообщения в списке чатов
+const previewLength = 100
+
+type chatListItem struct {
+	models.Chat
+	MessageCount      int64           `json:"message_count"`
+	LastMessage       *models.Message `json:"last_message"`
+	LastReadMessageID *uint           `json:"last_read_message_id"`
+	UnreadCount       int64           `json:"unread_count"`
+	FirstUnreadID     *uint           `json:"first_unread_id"`
+	PeerID            *uint           `json:"peer_id,omitempty"`
+}
+
+// directPeer собеседник в личном чате, у группового nil
+func directPeer(chat *models.Chat, userID uint) *uint {
+	if chat.Type != models.ChatDirect || chat.DirectUser1ID == nil || chat.DirectUser2ID == nil {
+		return nil
+	}
+	if *chat.DirectUser1ID == userID {
+		return chat.DirectUser2ID
+	}
+	return chat.DirectUser1ID
+}
+
+// chatCursor позиция в списке чатов, клиенту отдается как непрозрачная строка
+type chatCursor struct {
+	LastActivityAt time.Time `json:"t"`
+	ID             uint      `json:"id"`
+}
+
+func encodeChatCursor(c chatCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeChatCursor(s string) (chatCursor, bool) {
+	var c chatCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.ID == 0 {
+		return chatCursor{}, false
+	}
+	return c, true
+}
+
+func (h *Handler) ListChats(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.currentUserID(r)
+	query := r.URL.Query()
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			if l > 100 {
+				l = 100
+			}
+			limit = l
+		}
+	}
+
+	// берем на один больше чтобы понять есть ли следующая страница
+	list := store.ChatListQuery{UserID: userID, Prefix: strings.TrimSpace(query.Get("prefix")), Limit: limit + 1}
+	if cursorStr := query.Get("cursor"); cursorStr != "" {
+		cursor, ok := decodeChatCursor(cursorStr)
+		if !ok {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Invalid cursor")
+			return
+		}
+		list.Cursor = &store.ChatCursor{LastActivityAt: cursor.LastActivityAt, ID: cursor.ID}
+	}
+
+	// ответы в тредах не считаются ни в message_count, ни в непрочитанных
+	summaries, err := h.Chats.ListChats(r.Context(), list)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list chats")
+		return
+	}
+	chats := make([]chatListItem, len(summaries))
+	for i, c := range summaries {
+		chats[i] = chatListItem{
+			Chat:              c.Chat,
+			MessageCount:      c.MessageCount,
+			LastReadMessageID: c.LastReadMessageID,
+			UnreadCount:       c.Unread.Count,
+			FirstUnreadID:     c.Unread.FirstID,
+		}
+	}
+
+	var nextCursor *string
+	if len(chats) > limit {
+		chats = chats[:limit]
+		last := chats[limit-1]
+		c := encodeChatCursor(chatCursor{LastActivityAt: last.LastActivityAt, ID: last.ID})
+		nextCursor = &c
+	}
+
+	if err := h.attachLastMessages(r.Context(), chats); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list chats")
+		return
+	}
+	for i := range chats {
+		chats[i].PeerID = directPeer(&chats[i].Chat, userID)
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Chats      []chatListItem `json:"chats"`
+		NextCursor *string        `json:"next_cursor"`
+	}{
+		Chats:      chats,
+		NextCursor: nextCursor,
+	})
+}
+
+// attachLastMessages подтягивает последнее сообщение каждого чата одним запросом
+func (h *Handler) attachLastMessages(ctx context.Context, chats []chatListItem) error {
+	if len(chats) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(chats))
+	for i, c := range chats {
+		ids[i] = c.ID
+	}
+
+	messages, err := h.Messages.LastMessages(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	byChat := make(map[uint]*models.Message, len(messages))
+	for i := range messages {
+		m := &messages[i]
+		if runes := []rune(m.Text); len(runes) > previewLength {
+			m.Text = string(runes[:previewLength]) + "…"
+		}
+		byChat[m.ChatID] = m
+	}
+	for i := range chats {
+		chats[i].LastMessage = byChat[chats[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+// DirectChat возвращает личный чат текущего пользователя с {userID}, создает его при первом вызове.
+// чат у пары всегда один: 201 если создан сейчас, 200 если уже был
+func (h *Handler) DirectChat(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	peerID, err := strconv.Atoi(vars["userID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid user ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+	if uint(peerID) == userID {
+		problem.Write(w, r, http.StatusBadRequest, problem.DirectChatWithSelf, "Cannot start a direct chat with yourself")
+		return
+	}
+
+	peer, err := h.Users.User(r.Context(), uint(peerID))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
+			return
+		}
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load user")
+		return
+	}
+
+	low, high := userID, peer.ID
+	if low > high {
+		low, high = high, low
+	}
+
+	chat, err := h.Chats.DirectChat(r.Context(), low, high)
+	if err == nil {
+		json.NewEncoder(w).Encode(chat)
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to open direct chat")
+		return
+	}
+
+	now := time.Now()
+	created := models.Chat{
+		Type:           models.ChatDirect,
+		DirectUser1ID:  &low,
+		DirectUser2ID:  &high,
+		CreatedAt:      now,
+		LastActivityAt: now,
+	}
+	// владельца у личного чата нет, оба просто участники
+	err = h.Chats.CreateChat(r.Context(), &created, []models.ChatMember{
+		{UserID: low, Role: models.RoleMember, CreatedAt: now},
+		{UserID: high, Role: models.RoleMember, CreatedAt: now},
+	})
+	if err != nil {
+		// параллельный запрос той же пары успел раньше, уникальный индекс не дал завести второй
+		if chat, findErr := h.Chats.DirectChat(r.Context(), low, high); findErr == nil {
+			json.NewEncoder(w).Encode(chat)
+			return
+		}
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to open direct chat")
+		return
+	}
+
+	h.Metrics.ChatCreated(created.Type)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/metrics"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+)
+
+const (
+	// комментарий-пинг чтобы прокси не рвали тихий поток
+	sseKeepAlive = 30 * time.Second
+	// сколько пропущенных сообщений читаем из базы за раз при докачке
+	sseReplayBatch = 100
+)
+
+// ChatEvents поток событий чата в формате text/event-stream для клиентов без вебсокетов.
+// id события это ид сообщения, по Last-Event-ID переподключенный клиент получает пропущенное
+func (h *Handler) ChatEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID); !ok {
+		return
+	}
+
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		lastEventID, err = strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Invalid Last-Event-ID")
+			return
+		}
+	}
+
+	// поток живет дольше WriteTimeout сервера, снимаем дедлайн только для него
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Streaming unsupported")
+		return
+	}
+
+	// подписываемся до докачки, чтобы не потерять сообщения между запросом в базу и потоком
+	sub := h.Hub.Subscribe(chat.ID, socketEventBuffer)
+	defer h.Hub.Unsubscribe(sub)
+	h.touchOnline(r.Context(), chat.ID, userID)
+	h.Metrics.ConnectionOpened(metrics.TransportSSE)
+	defer h.Metrics.ConnectionClosed(metrics.TransportSSE)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	lastSent := uint(lastEventID)
+	if lastEventID > 0 {
+		lastSent, err = h.replayMessages(r.Context(), w, chat.ID, lastSent)
+		if err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// не успевал читать, клиент переподключится и докачает по Last-Event-ID
+				return
+			}
+			// уже отправлено при докачке
+			if event.Type == realtime.EventMessageCreated && event.ID <= lastSent {
+				continue
+			}
+			if err := writeSSE(w, event); err != nil {
+				return
+			}
+			if event.ID > lastSent {
+				lastSent = event.ID
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			if event.Type == realtime.EventChatDeleted || event.Removes(userID) {
+				return
+			}
+		case <-ticker.C:
+			h.touchOnline(r.Context(), chat.ID, userID)
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// replayMessages отправляет сообщения чата новее afterID и возвращает ид последнего
+func (h *Handler) replayMessages(ctx context.Context, w http.ResponseWriter, chatID, afterID uint) (uint, error) {
+	for {
+		messages, err := h.Messages.MessagesAfterID(ctx, chatID, afterID, sseReplayBatch)
+		if err != nil {
+			return afterID, err
+		}
+
+		for _, message := range messages {
+			event := realtime.Event{Type: realtime.EventMessageCreated, ChatID: chatID, ID: message.ID, Data: message}
+			if err := writeSSE(w, event); err != nil {
+				return afterID, err
+			}
+			afterID = message.ID
+		}
+		if len(messages) < sseReplayBatch {
+			return afterID, nil
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, event realtime.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
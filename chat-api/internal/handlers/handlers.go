@@ -1,55 +1,164 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"gorm.io/gorm"
 
+	"chat-api/internal/auth"
+	"chat-api/internal/emoji"
+	"chat-api/internal/metrics"
+	"chat-api/internal/middleware"
 	"chat-api/internal/models"
+	"chat-api/internal/presence"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/requestid"
+	"chat-api/internal/storage"
+	"chat-api/internal/store"
 )
 
 type Handler struct {
-	DB *gorm.DB
+	// все запросы к данным идут через хранилища, обработчики о базе не знают
+	Users       store.UserStore
+	Chats       store.ChatStore
+	Messages    store.MessageStore
+	Attachments store.AttachmentStore
+	Auth        *auth.Issuer
+	Hub         *realtime.Hub
+	Emoji       *emoji.Registry // nil - только юникод эмодзи
+	// кто печатает и кто онлайн, в базу не попадает
+	Presence  presence.Store
+	TypingTTL time.Duration
+	OnlineTTL time.Duration
+	// содержимое вложений, в базе только метаданные
+	Blobs       storage.BlobStore
+	UploadLimit int64
+	PinLimit    int              // сколько сообщений можно закрепить в одном чате
+	Metrics     *metrics.Metrics // nil - метрики не собираются
+	Logger      *slog.Logger     // nil - slog.Default()
 }
 
-func InitHandlers(r *mux.Router, db *gorm.DB) {
-	h := &Handler{DB: db}
+// logger логгер обработчиков, с ид запроса если он есть в ctx
+func (h *Handler) logger(ctx context.Context) *slog.Logger {
+	logger := h.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
 
-	r.HandleFunc("/chats", h.CreateChat).Methods("POST")
-	r.HandleFunc("/chats/{id}/messages", h.CreateMessage).Methods("POST")
-	r.HandleFunc("/chats/{id}", h.GetChat).Methods("GET")
-	r.HandleFunc("/chats/{id}", h.DeleteChat).Methods("DELETE")
+func InitHandlers(r *mux.Router, h *Handler) {
+	// чужие адреса тоже отвечают problem+json, а не текстом
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusNotFound, problem.RouteNotFound, "Route not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.MethodNotAllowed, "Method not allowed")
+	})
+
+	// открытые маршруты
+	r.HandleFunc("/auth/register", h.Register).Methods("POST")
+	r.HandleFunc("/auth/login", h.Login).Methods("POST")
 	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	// загрузка по токену из POST /chats/{id}/attachments, токен и есть авторизация
+	r.HandleFunc("/uploads/{token}", h.UploadAttachment).Methods("PUT")
+
+	// все остальное только с токеном
+	protected := func(f http.HandlerFunc) http.Handler {
+		return middleware.Auth(h.Auth)(f)
+	}
+	r.Handle("/chats", protected(h.ListChats)).Methods("GET")
+	r.Handle("/search", protected(h.Search)).Methods("GET")
+	r.Handle("/me/mentions", protected(h.ListMentions)).Methods("GET")
+	r.Handle("/me/mentions/read", protected(h.MarkMentionsRead)).Methods("POST")
+	r.Handle("/chats", protected(h.CreateChat)).Methods("POST")
+	r.Handle("/dm/{userID}", protected(h.DirectChat)).Methods("POST")
+	r.Handle("/chats/{id}/messages", protected(h.CreateMessage)).Methods("POST")
+	r.Handle("/chats/{id}/messages/{msgID}", protected(h.EditMessage)).Methods("PATCH")
+	r.Handle("/chats/{id}/messages/{msgID}", protected(h.DeleteMessage)).Methods("DELETE")
+	r.Handle("/chats/{id}/messages/{msgID}/revisions", protected(h.ListRevisions)).Methods("GET")
+	r.Handle("/chats/{id}/messages/{msgID}/thread", protected(h.GetThread)).Methods("GET")
+	r.Handle("/chats/{id}/messages/{msgID}/reactions/{emoji}", protected(h.AddReaction)).Methods("PUT")
+	r.Handle("/chats/{id}/messages/{msgID}/reactions/{emoji}", protected(h.RemoveReaction)).Methods("DELETE")
+	r.Handle("/chats/{id}/pins", protected(h.ListPins)).Methods("GET")
+	r.Handle("/chats/{id}/pins/{msgID}", protected(h.PinMessage)).Methods("POST")
+	r.Handle("/chats/{id}/pins/{msgID}", protected(h.UnpinMessage)).Methods("DELETE")
+	r.Handle("/chats/{id}/attachments", protected(h.CreateAttachment)).Methods("POST")
+	r.Handle("/attachments/{id}", protected(h.GetAttachment)).Methods("GET")
+	r.Handle("/attachments/{id}/thumbnails/{size}", protected(h.GetThumbnail)).Methods("GET")
+	r.Handle("/chats/{id}/read", protected(h.MarkRead)).Methods("POST")
+	r.Handle("/chats/{id}/typing", protected(h.Typing)).Methods("POST")
+	r.Handle("/chats/{id}/presence", protected(h.GetPresence)).Methods("GET")
+	r.Handle("/chats/{id}/ws", protected(h.ChatSocket)).Methods("GET")
+	r.Handle("/chats/{id}/events", protected(h.ChatEvents)).Methods("GET")
+	r.Handle("/chats/{id}", protected(h.GetChat)).Methods("GET")
+	r.Handle("/chats/{id}", protected(h.DeleteChat)).Methods("DELETE")
+	r.Handle("/chats/{id}/members", protected(h.ListMembers)).Methods("GET")
+	r.Handle("/chats/{id}/members", protected(h.AddMember)).Methods("POST")
+	r.Handle("/chats/{id}/members/{userID}", protected(h.RemoveMember)).Methods("DELETE")
+	r.Handle("/chats/{id}/subscription", protected(h.Subscribe)).Methods("PUT")
+	r.Handle("/chats/{id}/subscription", protected(h.Unsubscribe)).Methods("DELETE")
 }
 
 func (h *Handler) CreateChat(w http.ResponseWriter, r *http.Request) {
 	var request struct {
+		Type  string `json:"type"`
 		Title string `json:"title"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request - body", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request - body")
 		return
 	}
 	title := strings.TrimSpace(request.Title)
-	if title == "" || len(title) > 200 {
-		http.Error(w, "Title must be between 1 and 200 characters", http.StatusBadRequest)
+	if request.Type == "" {
+		request.Type = models.ChatGroup
+	}
+	switch request.Type {
+	case models.ChatGroup, models.ChatChannel:
+		if title == "" || len(title) > 200 {
+			problem.Invalid(w, r, problem.FieldError{Field: "title", Code: problem.FieldLength, Message: "Title must be between 1 and 200 characters"})
+			return
+		}
+	case models.ChatDirect:
+		// у личного чата названия нет, а участники задаются парой
+		problem.Invalid(w, r, problem.FieldError{Field: "type", Code: problem.FieldInvalid, Message: "Direct chats are created with POST /dm/{userID}"})
+		return
+	default:
+		problem.Invalid(w, r, problem.FieldError{Field: "type", Code: problem.FieldInvalid, Message: "Type must be group, channel or direct"})
 		return
 	}
 
+	userID, _ := h.currentUserID(r)
+
+	now := time.Now()
 	chat := models.Chat{
-		Title:     title,
-		CreatedAt: time.Now(),
+		Type:           request.Type,
+		Title:          title,
+		CreatedAt:      now,
+		LastActivityAt: now,
 	}
-	if err := h.DB.Create(&chat).Error; err != nil {
-		http.Error(w, "Failed to create chat", http.StatusInternalServerError)
+	// создатель сразу становится владельцем
+	err := h.Chats.CreateChat(r.Context(), &chat, []models.ChatMember{
+		{UserID: userID, Role: models.RoleOwner, CreatedAt: chat.CreatedAt},
+	})
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to create chat")
 		return
 	}
+	h.Metrics.ChatCreated(chat.Type)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(chat)
 }
@@ -58,41 +167,66 @@ func (h *Handler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chatID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
 		return
 	}
 
-	// проверка существования чата
-	var chat models.Chat
-	if err := h.DB.First(&chat, chatID).Error; err != nil {
-		http.Error(w, "Chat not found", http.StatusNotFound)
+	// автор берется из токена
+	userID, ok := h.currentUserID(r)
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Unauthorized")
 		return
 	}
 
-	var request struct {
-		Text string `json:"text"`
+	// проверка существования чата
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	// писать могут только участники, в канале только владелец и админы
+	if _, ok := h.requirePublisher(w, r, chat, userID); !ok {
+		return
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	// файлы можно прислать прямо в multipart форме или заранее загрузить по токену
+	request := &messageRequest{}
+	var uploaded []models.Attachment
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		var p *problem.Problem
+		request, uploaded, p = h.readMultipartMessage(w, r, chat.ID, userID)
+		if p != nil {
+			problem.Send(w, r, p)
+			return
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
 		return
 	}
+	// при ошибке дальше загруженные в этом запросе файлы не нужны
+	failed := func(err error) {
+		h.deleteAttachments(r.Context(), uploaded)
+		problem.Send(w, r, problem.From(err, "Failed to create message"))
+	}
 
 	//проверка на длинну
-	text := strings.TrimSpace(request.Text)
-	if text == "" || len(text) > 5000 {
-		http.Error(w, "Text must be between 1 and 5000 characters", http.StatusBadRequest)
+	text, ok := validateMessageBody(request.Text, len(request.AttachmentIDs))
+	if !ok {
+		failed(errInvalidText)
 		return
 	}
 
-	message := models.Message{
-		ChatID:    uint(chatID),
-		Text:      text,
-		CreatedAt: time.Now(),
+	// ответ в ветку
+	if request.ParentID != nil {
+		if err := h.checkParent(r.Context(), chat.ID, *request.ParentID); err != nil {
+			failed(err)
+			return
+		}
 	}
 
-	if err := h.DB.Create(&message).Error; err != nil {
-		http.Error(w, "Failed to create message", http.StatusInternalServerError)
+	// занятые вложения и упоминания не участников приходят готовыми ошибками для клиента
+	message, err := h.saveMessage(r.Context(), chat.ID, userID, text, request.ParentID, request.AttachmentIDs)
+	if err != nil {
+		failed(err)
 		return
 	}
 
@@ -100,11 +234,88 @@ func (h *Handler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(message)
 }
 
+type messageRequest struct {
+	Text          string `json:"text"`
+	ParentID      *uint  `json:"parent_id"`
+	AttachmentIDs []uint `json:"attachment_ids"`
+}
+
+// validateMessageText обрезает пробелы и проверяет длину текста сообщения
+func validateMessageText(text string) (string, bool) {
+	text = strings.TrimSpace(text)
+	return text, text != "" && len(text) <= 5000
+}
+
+// validateMessageBody как validateMessageText, но сообщение с вложениями может быть без текста
+func validateMessageBody(text string, attachments int) (string, bool) {
+	text, ok := validateMessageText(text)
+	return text, ok || (text == "" && attachments > 0)
+}
+
+var (
+	errParentNotFound = problem.New(http.StatusNotFound, problem.ParentNotFound, "Parent message not found")
+	errNestedReply    = problem.New(http.StatusBadRequest, problem.NestedReply, "Replies can only be posted to root messages")
+	errInvalidText    = &problem.Problem{
+		Status: http.StatusBadRequest,
+		Code:   problem.ValidationFailed,
+		Detail: "Text must be between 1 and 5000 characters",
+		Errors: []problem.FieldError{{Field: "text", Code: problem.FieldLength, Message: "Text must be between 1 and 5000 characters"}},
+	}
+)
+
+// checkParent проверяет что ответ идет на живое корневое сообщение того же чата
+func (h *Handler) checkParent(ctx context.Context, chatID, parentID uint) error {
+	parent, err := h.Messages.Message(ctx, chatID, parentID, false)
+	if errors.Is(err, store.ErrNotFound) {
+		return errParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil {
+		return errNestedReply
+	}
+	return nil
+}
+
+// saveMessage сохраняет сообщение и после коммита рассылает его подписчикам чата,
+// parentID задает ветку, родитель должен быть проверен через checkParent
+func (h *Handler) saveMessage(ctx context.Context, chatID, authorID uint, text string, parentID *uint, attachmentIDs []uint) (*models.Message, error) {
+	if countUnique(attachmentIDs) > maxMessageAttachments {
+		return nil, errAttachmentUnavailable
+	}
+
+	message := models.Message{
+		ChatID:    chatID,
+		AuthorID:  &authorID,
+		ParentID:  parentID,
+		Text:      text,
+		CreatedAt: time.Now(),
+	}
+	mentions, mentionAll, err := h.resolveMentions(ctx, &message)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.Messages.CreateMessage(ctx, &message, attachmentIDs, mentions, mentionAll)
+	if errors.Is(err, store.ErrAttachmentUnavailable) {
+		return nil, errAttachmentUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.Metrics.MessageCreated()
+	h.Hub.Publish(realtime.Event{Type: realtime.EventMessageCreated, ChatID: chatID, ID: message.ID, Data: message})
+	h.clearTyping(ctx, chatID, authorID)
+	return &message, nil
+}
+
 func (h *Handler) GetChat(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chatID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
 		return
 	}
 
@@ -120,30 +331,132 @@ func (h *Handler) GetChat(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//поиск чата по ид
-	var chat models.Chat
-	if err := h.DB.First(&chat, chatID).Error; err != nil {
-		http.Error(w, "Chat not found", http.StatusNotFound)
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	userID, _ := h.currentUserID(r)
+	member, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return
+	}
+
+	//курсоры по ид сообщения, можно указать только один
+	var cursorName string
+	var cursorID uint
+	for _, name := range []string{"before", "after", "around"} {
+		value := r.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		if cursorName != "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Only one of before, after, around is allowed")
+			return
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Invalid "+name+" cursor")
+			return
+		}
+		cursorName, cursorID = name, uint(id)
+	}
+
+	var pivot *models.Message
+	if cursorName != "" {
+		// курсором может быть и удаленное сообщение, оно есть в истории заглушкой
+		pivot, err = h.Messages.Message(r.Context(), chat.ID, cursorID, true)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, problem.CursorNotFound, "Cursor message not found")
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+			return
+		}
+	}
+
+	// в ленте чата только корневые сообщения, ответы смотрятся через /thread
+	timeline := store.Timeline{ChatID: chat.ID}
+	if pivot != nil && pivot.ParentID != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Cursor message is a thread reply")
 		return
 	}
 
-	//последние сообщения
 	var messages []models.Message
-	h.DB.Where("chat_id = ?", chatID).
-		Order("created_at DESC").
-		Limit(limit).
-		Find(&messages)
+	var hasOlder, hasNewer bool
+	switch cursorName {
+	case "":
+		//последние сообщения
+		messages, hasOlder, err = h.Messages.Before(r.Context(), timeline, nil, limit)
+	case "before":
+		messages, hasOlder, err = h.Messages.Before(r.Context(), timeline, pivot, limit)
+		hasNewer = true
+	case "after":
+		messages, hasNewer, err = h.Messages.After(r.Context(), timeline, pivot, limit)
+		hasOlder = true
+	case "around":
+		// сообщение-курсор посередине страницы
+		var older, newer []models.Message
+		older, hasOlder, err = h.Messages.Before(r.Context(), timeline, pivot, limit/2)
+		if err == nil {
+			newer, hasNewer, err = h.Messages.After(r.Context(), timeline, pivot, limit-limit/2-1)
+		}
+		messages = append(append(older, *pivot), newer...)
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+		return
+	}
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	if err := h.attachReactions(r.Context(), messages, userID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+		return
+	}
+	if err := h.attachFiles(r.Context(), messages); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+		return
+	}
 
-	//порядок для правильной сортировки
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	read, err := h.readState(r.Context(), member)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+		return
+	}
+	pinned, err := h.Messages.PinnedIDs(r.Context(), chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load messages")
+		return
+	}
+
+	// prev ведет к более старым сообщениям, next к более новым
+	var prevCursor, nextCursor *uint
+	if len(messages) > 0 {
+		if hasOlder {
+			prevCursor = &messages[0].ID
+		}
+		if hasNewer {
+			nextCursor = &messages[len(messages)-1].ID
+		}
 	}
 
 	response := struct {
 		models.Chat
-		Messages []models.Message `json:"messages"`
+		readState
+		PeerID           *uint            `json:"peer_id,omitempty"`
+		PinnedMessageIDs []uint           `json:"pinned_message_ids"`
+		Messages         []models.Message `json:"messages"`
+		PrevCursor       *uint            `json:"prev_cursor"`
+		NextCursor       *uint            `json:"next_cursor"`
 	}{
-		Chat:     chat,
-		Messages: messages,
+		Chat:             *chat,
+		readState:        read,
+		PeerID:           directPeer(chat, userID),
+		PinnedMessageIDs: pinned,
+		Messages:         messages,
+		PrevCursor:       prevCursor,
+		NextCursor:       nextCursor,
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -153,21 +466,34 @@ func (h *Handler) DeleteChat(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	chatID, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid chat ID", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
 		return
 	}
 
-	//(сообщения удалятся каскадно из-за constraint)
-	result := h.DB.Delete(&models.Chat{}, chatID)
-	if result.Error != nil {
-		http.Error(w, "Failed to delete chat", http.StatusInternalServerError)
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	// удалить может только владелец, а у личного чата его нет: там удаляет любой из двух,
+	// и чат пропадает у обоих
+	userID, _ := h.currentUserID(r)
+	roles := []string{models.RoleOwner}
+	if chat.Type == models.ChatDirect {
+		roles = nil
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID, roles...); !ok {
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		http.Error(w, "Chat not found", http.StatusNotFound)
+	// сообщения и участники удаляются вместе с чатом, файлы вложений убираем после строк
+	blobKeys, err := h.Chats.DeleteChat(r.Context(), chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to delete chat")
 		return
 	}
+	h.deleteBlobs(r.Context(), blobKeys...)
+	h.Metrics.ChatDeleted()
+	h.Hub.Publish(realtime.Event{Type: realtime.EventChatDeleted, ChatID: chat.ID, Data: map[string]uint{"id": chat.ID}})
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/store"
+)
+
+// loadChat ищет чат по ид, при ошибке сам пишет ответ
+func (h *Handler) loadChat(w http.ResponseWriter, r *http.Request, chatID uint) (*models.Chat, bool) {
+	chat, err := h.Chats.Chat(r.Context(), chatID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.ChatNotFound, "Chat not found")
+		return nil, false
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load chat")
+		return nil, false
+	}
+	return chat, true
+}
+
+// requireMember проверяет что пользователь участник чата с одной из ролей
+// (без ролей подходит любой участник), при отказе сам пишет ответ
+func (h *Handler) requireMember(w http.ResponseWriter, r *http.Request, chatID, userID uint, roles ...string) (*models.ChatMember, bool) {
+	member, err := h.Chats.Member(r.Context(), chatID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusForbidden, problem.NotMember, "Not a chat member")
+		return nil, false
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to check membership")
+		return nil, false
+	}
+
+	if len(roles) == 0 {
+		return member, true
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return member, true
+		}
+	}
+	problem.Write(w, r, http.StatusForbidden, problem.InsufficientRole, "Insufficient chat role")
+	return nil, false
+}
+
+func (h *Handler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID); !ok {
+		return
+	}
+
+	members, err := h.Chats.Members(r.Context(), chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list members")
+		return
+	}
+
+	json.NewEncoder(w).Encode(members)
+}
+
+func (h *Handler) AddMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	var request struct {
+		UserID uint   `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+	if request.Role == "" {
+		request.Role = models.RoleMember
+	}
+	// владелец у чата один, его назначить нельзя
+	if request.Role != models.RoleMember && request.Role != models.RoleAdmin {
+		problem.Invalid(w, r, problem.FieldError{Field: "role", Code: problem.FieldInvalid, Message: "Role must be admin or member"})
+		return
+	}
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if chat.Type == models.ChatDirect {
+		problem.Write(w, r, http.StatusForbidden, problem.DirectChatFixed, "Members of a direct chat cannot be changed")
+		return
+	}
+
+	// админов назначает только владелец
+	allowed := []string{models.RoleOwner, models.RoleAdmin}
+	if request.Role == models.RoleAdmin {
+		allowed = []string{models.RoleOwner}
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID, allowed...); !ok {
+		return
+	}
+
+	user, err := h.Users.User(r.Context(), request.UserID)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load user")
+		return
+	}
+
+	member := models.ChatMember{
+		ChatID:    chat.ID,
+		UserID:    user.ID,
+		Role:      request.Role,
+		CreatedAt: time.Now(),
+	}
+	err = h.Chats.AddMember(r.Context(), &member)
+	if errors.Is(err, store.ErrConflict) {
+		problem.Write(w, r, http.StatusConflict, problem.AlreadyMember, "User is already a member")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to add member")
+		return
+	}
+	member.User = user
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	targetID, err := strconv.Atoi(vars["userID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid user ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	caller, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return
+	}
+	// из личного чата не выходят, иначе пара останется с чатом без одного участника
+	if chat.Type == models.ChatDirect {
+		problem.Write(w, r, http.StatusForbidden, problem.DirectChatFixed, "Members of a direct chat cannot be changed")
+		return
+	}
+
+	target, err := h.Chats.Member(r.Context(), chat.ID, uint(targetID))
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.MemberNotFound, "Member not found")
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to check membership")
+		return
+	}
+
+	// владелец не уходит из своего чата, его можно только удалить вместе с чатом
+	if target.Role == models.RoleOwner {
+		problem.Write(w, r, http.StatusForbidden, problem.OwnerCannotBeRemoved, "Owner cannot be removed")
+		return
+	}
+	// выйти может любой, остальных убирает владелец, а админ только обычных участников
+	if target.UserID != caller.UserID {
+		canRemove := caller.Role == models.RoleOwner ||
+			(caller.Role == models.RoleAdmin && target.Role == models.RoleMember)
+		if !canRemove {
+			problem.Write(w, r, http.StatusForbidden, problem.InsufficientRole, "Insufficient chat role")
+			return
+		}
+	}
+
+	if err := h.removeMember(r.Context(), chat.ID, target.UserID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to remove member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeMember убирает участника и уменьшает счетчик, если участник действительно был.
+// его открытые сокеты и SSE потоки закрываются по событию member.removed
+func (h *Handler) removeMember(ctx context.Context, chatID, userID uint) error {
+	removed, err := h.Chats.RemoveMember(ctx, chatID, userID)
+	if err == nil && removed {
+		h.Hub.Publish(realtime.Event{
+			Type:   realtime.EventMemberRemoved,
+			ChatID: chatID,
+			UserID: userID,
+			Data:   map[string]uint{"user_id": userID},
+		})
+	}
+	return err
+}
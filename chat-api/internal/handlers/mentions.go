@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+// mentionAll упоминание всех участников чата
+const mentionAll = "all"
+
+// @ в начале текста или после символа, который не может быть частью имени,
+// чтобы адреса вида user@example.com не считались упоминаниями
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@-])@([A-Za-z0-9_.-]{1,50})`)
+
+// mentionError упомянуты существующие пользователи, которых нет в чате
+func mentionError(usernames []string) *problem.Problem {
+	return problem.New(http.StatusBadRequest, problem.MentionNotMember,
+		"Mentioned users are not chat members: @"+strings.Join(usernames, ", @"))
+}
+
+// parseMentions имена из текста без @ в порядке появления, без повторов.
+// точка и дефис в конце обычно знаки препинания, поэтому пробуем и имя без них
+func parseMentions(text string) (candidates [][]string, all bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := match[1]
+		if name == mentionAll {
+			all = true
+			continue
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		variants := []string{name}
+		if trimmed := strings.TrimRight(name, ".-"); trimmed != name && trimmed != "" {
+			if trimmed == mentionAll {
+				all = true
+				continue
+			}
+			variants = append(variants, trimmed)
+		}
+		candidates = append(candidates, variants)
+	}
+	return candidates, all
+}
+
+// resolveMentions разбирает упоминания нового сообщения в записи для участников.
+// незнакомые имена остаются просто текстом, а существующий пользователь не из чата - ошибка.
+// all - упомянуты все: участников выбирает хранилище при записи, здесь их не грузим
+func (h *Handler) resolveMentions(ctx context.Context, message *models.Message) (mentions []models.MessageMention, all bool, err error) {
+	candidates, all := parseMentions(message.Text)
+	if len(candidates) == 0 {
+		return nil, all, nil
+	}
+
+	var names []string
+	for _, variants := range candidates {
+		names = append(names, variants...)
+	}
+	users, err := h.Users.UsersByNames(ctx, names)
+	if err != nil {
+		return nil, false, err
+	}
+	byName := make(map[string]models.User, len(users))
+	userIDs := make([]uint, 0, len(users))
+	for _, u := range users {
+		byName[u.Username] = u
+		userIDs = append(userIDs, u.ID)
+	}
+
+	// проверяем только упомянутых, а не весь состав чата
+	memberIDs, err := h.Chats.MemberIDs(ctx, message.ChatID, userIDs)
+	if err != nil {
+		return nil, false, err
+	}
+	isMember := make(map[uint]bool, len(memberIDs))
+	for _, id := range memberIDs {
+		isMember[id] = true
+	}
+
+	seen := make(map[uint]bool)
+	var outsiders []string
+	for _, variants := range candidates {
+		for _, name := range variants {
+			u, ok := byName[name]
+			if !ok {
+				continue
+			}
+			switch {
+			case !isMember[u.ID]:
+				outsiders = append(outsiders, u.Username)
+			case seen[u.ID]:
+			// себя не уведомляем
+			case message.AuthorID != nil && u.ID == *message.AuthorID:
+			default:
+				seen[u.ID] = true
+				mentions = append(mentions, models.MessageMention{
+					UserID:    u.ID,
+					ChatID:    message.ChatID,
+					CreatedAt: message.CreatedAt,
+				})
+			}
+			break
+		}
+	}
+	if len(outsiders) > 0 {
+		return nil, false, mentionError(outsiders)
+	}
+	return mentions, all, nil
+}
+
+// mentionItem строка входящих: упоминание, чат и само сообщение
+type mentionItem struct {
+	MessageID uint            `json:"message_id"`
+	ChatID    uint            `json:"chat_id"`
+	ChatTitle string          `json:"chat_title"`
+	Everyone  bool            `json:"everyone"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+	Message   *models.Message `json:"message"`
+}
+
+// ListMentions входящие упоминания текущего пользователя, новые первыми.
+// unread=true оставляет непрочитанные, chat_id - только один чат, листается через before
+func (h *Handler) ListMentions(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.currentUserID(r)
+	query := r.URL.Query()
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			if l > 100 {
+				l = 100
+			}
+			limit = l
+		}
+	}
+
+	// берем на один больше чтобы понять есть ли следующая страница
+	mentions := store.MentionQuery{UserID: userID, Unread: query.Get("unread") == "true", Limit: limit + 1}
+	if chatStr := query.Get("chat_id"); chatStr != "" {
+		chatID, err := strconv.ParseUint(chatStr, 10, 64)
+		if err != nil || chatID == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+			return
+		}
+		mentions.ChatID = uint(chatID)
+	}
+	if beforeStr := query.Get("before"); beforeStr != "" {
+		// 0 в хранилище значит "с самых новых", курсором он быть не может
+		before, err := strconv.ParseUint(beforeStr, 10, 64)
+		if err != nil || before == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Invalid cursor")
+			return
+		}
+		mentions.Before = uint(before)
+	}
+
+	hits, err := h.Messages.Mentions(r.Context(), mentions)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list mentions")
+		return
+	}
+	items := make([]mentionItem, len(hits))
+	for i, hit := range hits {
+		items[i] = mentionItem{
+			MessageID: hit.MessageID,
+			ChatID:    hit.ChatID,
+			ChatTitle: hit.ChatTitle,
+			Everyone:  hit.Everyone,
+			ReadAt:    hit.ReadAt,
+			CreatedAt: hit.CreatedAt,
+		}
+	}
+	var nextCursor *uint
+	if len(items) > limit {
+		items = items[:limit]
+		next := items[limit-1].MessageID
+		nextCursor = &next
+	}
+
+	if err := h.attachMentionMessages(r.Context(), items, userID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list mentions")
+		return
+	}
+
+	unread, err := h.Messages.UnreadMentions(r.Context(), userID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list mentions")
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Mentions    []mentionItem `json:"mentions"`
+		UnreadCount int64         `json:"unread_count"`
+		NextCursor  *uint         `json:"next_cursor"`
+	}{
+		Mentions:    items,
+		UnreadCount: unread,
+		NextCursor:  nextCursor,
+	})
+}
+
+// attachMentionMessages подтягивает сообщения упоминаний с реакциями и вложениями
+func (h *Handler) attachMentionMessages(ctx context.Context, items []mentionItem, userID uint) error {
+	if len(items) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(items))
+	for i, item := range items {
+		ids[i] = item.MessageID
+	}
+
+	messages, err := h.Messages.MessagesByID(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if err := h.attachReactions(ctx, messages, userID); err != nil {
+		return err
+	}
+	if err := h.attachFiles(ctx, messages); err != nil {
+		return err
+	}
+
+	byID := make(map[uint]*models.Message, len(messages))
+	for i := range messages {
+		byID[messages[i].ID] = &messages[i]
+	}
+	for i := range items {
+		items[i].Message = byID[items[i].MessageID]
+	}
+	return nil
+}
+
+// MarkMentionsRead отмечает упоминания прочитанными: перечисленные в message_ids,
+// без них все. упоминания в ленте чата читаются и через POST /chats/{id}/read
+func (h *Handler) MarkMentionsRead(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.currentUserID(r)
+
+	var request struct {
+		MessageIDs []uint `json:"message_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	if err := h.Messages.MarkMentionsRead(r.Context(), userID, request.MessageIDs); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to mark mentions read")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
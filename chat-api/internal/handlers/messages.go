@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/store"
+)
+
+// chatMessage разбирает {id} и {msgID} из пути, проверяет членство в чате
+// и ищет сообщение внутри этого чата, при ошибке сам пишет ответ
+func (h *Handler) chatMessage(w http.ResponseWriter, r *http.Request, withDeleted bool) (*models.ChatMember, *models.Message, bool) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return nil, nil, false
+	}
+	messageID, err := strconv.Atoi(vars["msgID"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid message ID")
+		return nil, nil, false
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return nil, nil, false
+	}
+	member, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return nil, nil, false
+	}
+
+	message, err := h.Messages.Message(r.Context(), chat.ID, uint(messageID), withDeleted)
+	if errors.Is(err, store.ErrNotFound) {
+		problem.Write(w, r, http.StatusNotFound, problem.MessageNotFound, "Message not found")
+		return nil, nil, false
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load message")
+		return nil, nil, false
+	}
+	return member, message, true
+}
+
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	member, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+
+	// править может только автор
+	if message.AuthorID == nil || *message.AuthorID != member.UserID {
+		problem.Write(w, r, http.StatusForbidden, problem.NotAuthor, "Only the author can edit a message")
+		return
+	}
+
+	var request struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	text, ok := validateMessageText(request.Text)
+	if !ok {
+		problem.Invalid(w, r, problem.FieldError{Field: "text", Code: problem.FieldLength, Message: "Text must be between 1 and 5000 characters"})
+		return
+	}
+
+	// тот же текст не создает новую ревизию
+	if text == message.Text {
+		json.NewEncoder(w).Encode(message)
+		return
+	}
+
+	if err := h.Messages.EditMessage(r.Context(), message, text, time.Now()); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to edit message")
+		return
+	}
+
+	h.Hub.Publish(realtime.Event{Type: realtime.EventMessageUpdated, ChatID: message.ChatID, Data: message})
+
+	json.NewEncoder(w).Encode(message)
+}
+
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	_, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.Messages.Revisions(r.Context(), message.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list revisions")
+		return
+	}
+	if revisions == nil {
+		revisions = []models.MessageRevision{}
+	}
+
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// DeleteMessage мягко удаляет сообщение, в истории остается заглушка.
+// С ?purge=true владелец или админ чата стирает сообщение из базы совсем, в том числе заглушку
+func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	purge := r.URL.Query().Get("purge") == "true"
+
+	member, message, ok := h.chatMessage(w, r, purge)
+	if !ok {
+		return
+	}
+
+	isModerator := member.Role == models.RoleOwner || member.Role == models.RoleAdmin
+	isAuthor := message.AuthorID != nil && *message.AuthorID == member.UserID
+	if purge && !isModerator {
+		problem.Write(w, r, http.StatusForbidden, problem.InsufficientRole, "Only chat owner or admin can purge messages")
+		return
+	}
+	if !isAuthor && !isModerator {
+		problem.Write(w, r, http.StatusForbidden, problem.NotAuthor, "Only the author or a chat admin can delete a message")
+		return
+	}
+
+	var err error
+	if purge {
+		err = h.purgeMessage(r.Context(), message)
+	} else {
+		// заглушка остается в ветке, поэтому счетчик ответов у корня не меняется,
+		// а закрепление снимается: на месте заглушки показывать нечего
+		err = h.Messages.DeleteMessage(r.Context(), message)
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to delete message")
+		return
+	}
+
+	h.Hub.Publish(realtime.Event{
+		Type:   realtime.EventMessageDeleted,
+		ChatID: message.ChatID,
+		Data:   map[string]interface{}{"id": message.ID, "purged": purge},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// purgeMessage стирает сообщение из базы: у корня вместе со всей веткой,
+// у ответа уменьшает счетчик ответов корня. Ревизии удаляются каскадно
+func (h *Handler) purgeMessage(ctx context.Context, message *models.Message) error {
+	// файлы вложений сообщения и его ответов удаляем после строк
+	blobKeys, err := h.Messages.PurgeMessage(ctx, message)
+	if err != nil {
+		return err
+	}
+	h.deleteBlobs(ctx, blobKeys...)
+	return nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/store"
+)
+
+// requirePinner пускает к закреплениям владельца и админов, а в личном чате
+// обоих собеседников: ролей там нет, оба просто участники. при отказе сам пишет ответ
+func (h *Handler) requirePinner(w http.ResponseWriter, r *http.Request, member *models.ChatMember, action string) bool {
+	chat, ok := h.loadChat(w, r, member.ChatID)
+	if !ok {
+		return false
+	}
+	if chat.Type == models.ChatDirect || member.Role == models.RoleOwner || member.Role == models.RoleAdmin {
+		return true
+	}
+	problem.Write(w, r, http.StatusForbidden, problem.InsufficientRole, "Only chat owner or admin can "+action+" messages")
+	return false
+}
+
+// PinMessage закрепляет сообщение в чате (владелец или админ, в личном чате любой из двух).
+// повторное закрепление ничего не меняет, сверх лимита чата - 409
+func (h *Handler) PinMessage(w http.ResponseWriter, r *http.Request) {
+	member, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+	if !h.requirePinner(w, r, member, "pin") {
+		return
+	}
+
+	pin := models.MessagePin{
+		ChatID:    message.ChatID,
+		MessageID: message.ID,
+		PinnedBy:  &member.UserID,
+		CreatedAt: time.Now(),
+	}
+	created, err := h.Messages.PinMessage(r.Context(), &pin, h.PinLimit)
+	if errors.Is(err, store.ErrLimit) {
+		problem.Write(w, r, http.StatusConflict, problem.PinLimitReached, fmt.Sprintf("At most %d pinned messages per chat", h.PinLimit))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to pin message")
+		return
+	}
+	pin.Message = message
+
+	if created {
+		h.publishPin(realtime.EventMessagePinned, message, member.UserID)
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(pin)
+}
+
+// UnpinMessage открепляет сообщение, права как у PinMessage
+func (h *Handler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
+	// удаленное сообщение открепляется само, так что ищем только живые
+	member, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+	if !h.requirePinner(w, r, member, "unpin") {
+		return
+	}
+
+	removed, err := h.Messages.UnpinMessage(r.Context(), message.ChatID, message.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to unpin message")
+		return
+	}
+	if !removed {
+		problem.Write(w, r, http.StatusNotFound, problem.NotPinned, "Message is not pinned")
+		return
+	}
+	h.publishPin(realtime.EventMessageUnpinned, message, member.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPins закрепленные сообщения чата, последние закрепленные первыми
+func (h *Handler) ListPins(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID); !ok {
+		return
+	}
+
+	pins, err := h.Messages.Pins(r.Context(), chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list pins")
+		return
+	}
+
+	messages := make([]models.Message, 0, len(pins))
+	for _, p := range pins {
+		if p.Message != nil {
+			messages = append(messages, *p.Message)
+		}
+	}
+	if err := h.attachReactions(r.Context(), messages, userID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list pins")
+		return
+	}
+	if err := h.attachFiles(r.Context(), messages); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to list pins")
+		return
+	}
+	for i, j := 0, 0; i < len(pins); i++ {
+		if pins[i].Message != nil {
+			pins[i].Message = &messages[j]
+			j++
+		}
+	}
+
+	if pins == nil {
+		pins = []models.MessagePin{}
+	}
+	json.NewEncoder(w).Encode(pins)
+}
+
+func (h *Handler) publishPin(eventType string, message *models.Message, userID uint) {
+	h.Hub.Publish(realtime.Event{
+		Type:   eventType,
+		ChatID: message.ChatID,
+		Data: map[string]interface{}{
+			"message_id": message.ID,
+			"user_id":    userID,
+		},
+	})
+}
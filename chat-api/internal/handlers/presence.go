@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/presence"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+)
+
+// Typing отмечает что пользователь печатает, клиент повторяет запрос пока печатает
+// чаще чем раз в TypingTTL. {"typing": false} снимает отметку сразу
+func (h *Handler) Typing(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	request := struct {
+		Typing *bool `json:"typing"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+	typing := request.Typing == nil || *request.Typing
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requirePublisher(w, r, chat, userID); !ok {
+		return
+	}
+
+	if typing {
+		err = h.Presence.Touch(r.Context(), presence.Typing, chat.ID, userID, h.TypingTTL)
+		if err == nil {
+			err = h.Presence.Touch(r.Context(), presence.Online, chat.ID, userID, h.OnlineTTL)
+		}
+	} else {
+		err = h.Presence.Clear(r.Context(), presence.Typing, chat.ID, userID)
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to update typing state")
+		return
+	}
+
+	h.Hub.Publish(realtime.Event{
+		Type:   realtime.EventTyping,
+		ChatID: chat.ID,
+		Data: map[string]interface{}{
+			"user_id": userID,
+			"typing":  typing,
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPresence кто из участников сейчас онлайн и кто печатает
+func (h *Handler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID); !ok {
+		return
+	}
+
+	online, err := h.Presence.Users(r.Context(), presence.Online, chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load presence")
+		return
+	}
+	typing, err := h.Presence.Users(r.Context(), presence.Typing, chat.ID)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load presence")
+		return
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Online []uint `json:"online"`
+		Typing []uint `json:"typing"`
+	}{
+		Online: online,
+		Typing: typing,
+	})
+}
+
+// touchOnline продлевает онлайн пока открыт сокет или поток событий,
+// ошибка хранилища не должна рвать соединение, поэтому только в лог
+func (h *Handler) touchOnline(ctx context.Context, chatID, userID uint) {
+	if err := h.Presence.Touch(ctx, presence.Online, chatID, userID, h.OnlineTTL); err != nil {
+		h.logger(ctx).Warn("presence update failed", "kind", presence.Online, "chat_id", chatID, "user_id", userID, "error", err)
+	}
+}
+
+// clearTyping отправленное сообщение заканчивает набор, событие не шлем:
+// клиенты и так прячут индикатор по message.created
+func (h *Handler) clearTyping(ctx context.Context, chatID, userID uint) {
+	if err := h.Presence.Clear(context.WithoutCancel(ctx), presence.Typing, chatID, userID); err != nil {
+		h.logger(ctx).Warn("presence update failed", "kind", presence.Typing, "chat_id", chatID, "user_id", userID, "error", err)
+	}
+}
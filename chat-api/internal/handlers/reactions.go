@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+)
+
+// AddReaction ставит реакцию текущего пользователя, повторный вызов ничего не меняет
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	member, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+
+	reaction := mux.Vars(r)["emoji"]
+	if !h.Emoji.Valid(reaction) {
+		problem.Invalid(w, r, problem.FieldError{Field: "emoji", Code: problem.FieldInvalid, Message: "Reaction must be a single emoji"})
+		return
+	}
+
+	added, err := h.Messages.AddReaction(r.Context(), &models.MessageReaction{
+		MessageID: message.ID,
+		UserID:    member.UserID,
+		Emoji:     reaction,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to add reaction")
+		return
+	}
+	if added {
+		h.publishReaction(realtime.EventReactionAdded, message, member.UserID, reaction)
+	}
+
+	h.writeReactions(w, r, message, member.UserID)
+}
+
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	member, message, ok := h.chatMessage(w, r, false)
+	if !ok {
+		return
+	}
+
+	reaction := mux.Vars(r)["emoji"]
+	removed, err := h.Messages.RemoveReaction(r.Context(), message.ID, member.UserID, reaction)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to remove reaction")
+		return
+	}
+	if removed {
+		h.publishReaction(realtime.EventReactionRemoved, message, member.UserID, reaction)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) publishReaction(eventType string, message *models.Message, userID uint, reaction string) {
+	h.Hub.Publish(realtime.Event{
+		Type:   eventType,
+		ChatID: message.ChatID,
+		Data: map[string]interface{}{
+			"message_id": message.ID,
+			"user_id":    userID,
+			"emoji":      reaction,
+		},
+	})
+}
+
+// writeReactions отвечает актуальной сводкой реакций сообщения
+func (h *Handler) writeReactions(w http.ResponseWriter, r *http.Request, message *models.Message, userID uint) {
+	messages := []models.Message{*message}
+	if err := h.attachReactions(r.Context(), messages, userID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load reactions")
+		return
+	}
+	reactions := messages[0].Reactions
+	if reactions == nil {
+		reactions = []models.ReactionCount{}
+	}
+	json.NewEncoder(w).Encode(reactions)
+}
+
+// attachReactions заполняет сводку реакций у живых сообщений одним запросом,
+// реакции идут в порядке первой постановки
+func (h *Handler) attachReactions(ctx context.Context, messages []models.Message, userID uint) error {
+	var ids []uint
+	for _, m := range messages {
+		if !m.DeletedAt.Valid {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	byMessage, err := h.Messages.Reactions(ctx, ids, userID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = byMessage[messages[i].ID]
+	}
+	return nil
+}
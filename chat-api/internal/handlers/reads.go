@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/store"
+)
+
+// readState позиция чтения участника и счетчик для бейджа
+type readState struct {
+	LastReadMessageID *uint `json:"last_read_message_id"`
+	UnreadCount       int64 `json:"unread_count"`
+	FirstUnreadID     *uint `json:"first_unread_id"`
+}
+
+// readState считает непрочитанное участника в чате
+func (h *Handler) readState(ctx context.Context, member *models.ChatMember) (readState, error) {
+	unread, err := h.Chats.Unread(ctx, member.ChatID, member.UserID)
+	return readState{
+		LastReadMessageID: member.LastReadMessageID,
+		UnreadCount:       unread.Count,
+		FirstUnreadID:     unread.FirstID,
+	}, err
+}
+
+// MarkRead двигает позицию чтения вперед, без message_id до последнего сообщения чата
+func (h *Handler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	var request struct {
+		MessageID uint `json:"message_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidBody, "Invalid request body")
+		return
+	}
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	member, ok := h.requireMember(w, r, chat.ID, userID)
+	if !ok {
+		return
+	}
+
+	readID := request.MessageID
+	if readID != 0 {
+		// прочитать можно и удаленное сообщение, оно видно в истории заглушкой
+		_, err := h.Messages.Message(r.Context(), chat.ID, readID, true)
+		if errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, http.StatusNotFound, problem.MessageNotFound, "Message not found")
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to mark chat read")
+			return
+		}
+	} else {
+		if readID, err = h.Messages.LastMessageID(r.Context(), chat.ID); err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to mark chat read")
+			return
+		}
+	}
+
+	// позиция только растет, старый запрос с другого устройства ее не откатит
+	if readID != 0 {
+		// упоминания в прочитанной части ленты тоже прочитаны, ответы в ветках нет
+		moved, err := h.Chats.MarkRead(r.Context(), chat.ID, userID, readID)
+		if err != nil {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to mark chat read")
+			return
+		}
+		if moved {
+			member.LastReadMessageID = &readID
+			h.Hub.Publish(realtime.Event{
+				Type:   realtime.EventReadUpdated,
+				ChatID: chat.ID,
+				Data: map[string]uint{
+					"user_id":              userID,
+					"last_read_message_id": readID,
+				},
+			})
+		}
+	}
+
+	state, err := h.readState(r.Context(), member)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to mark chat read")
+		return
+	}
+	json.NewEncoder(w).Encode(state)
+}
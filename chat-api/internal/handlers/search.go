@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+const (
+	// максимальная длина поискового запроса
+	searchMaxQueryLength = 200
+	// теги подсветки совпадений в сниппете
+	searchMarkStart = "<mark>"
+	searchMarkEnd   = "</mark>"
+)
+
+type searchResult struct {
+	Message   models.Message `json:"message"`
+	ChatTitle string         `json:"chat_title"`
+	Rank      float64        `json:"rank"`
+	Snippet   string         `json:"snippet"`
+}
+
+// Search ищет по сообщениям во всех чатах пользователя, лучшие совпадения первыми
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, _ := h.currentUserID(r)
+	query := r.URL.Query()
+
+	text := strings.TrimSpace(query.Get("q"))
+	if text == "" || len(text) > searchMaxQueryLength {
+		problem.Invalid(w, r, problem.FieldError{Field: "q", Code: problem.FieldLength, Message: "Query must be between 1 and 200 characters"})
+		return
+	}
+
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			if l > 100 {
+				l = 100
+			}
+			limit = l
+		}
+	}
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		o, err := strconv.Atoi(offsetStr)
+		if err != nil || o < 0 {
+			problem.Invalid(w, r, problem.FieldError{Field: "offset", Code: problem.FieldInvalid, Message: "Invalid offset"})
+			return
+		}
+		offset = o
+	}
+
+	search := store.SearchQuery{UserID: userID, Text: text, Offset: offset, Limit: limit + 1}
+	if chatIDStr := query.Get("chat_id"); chatIDStr != "" {
+		chatID, err := strconv.ParseUint(chatIDStr, 10, 64)
+		if err != nil || chatID == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+			return
+		}
+		search.ChatID = uint(chatID)
+	}
+	if authorIDStr := query.Get("author_id"); authorIDStr != "" {
+		authorID, err := strconv.ParseUint(authorIDStr, 10, 64)
+		if err != nil || authorID == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid author ID")
+			return
+		}
+		search.AuthorID = uint(authorID)
+	}
+	for _, bound := range []struct {
+		name  string
+		value **time.Time
+	}{
+		{"from", &search.From},
+		{"to", &search.To},
+	} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			message := "Invalid " + bound.name + " date, expected RFC3339"
+			problem.Invalid(w, r, problem.FieldError{Field: bound.name, Code: problem.FieldFormat, Message: message})
+			return
+		}
+		*bound.value = &t
+	}
+
+	// берем на один больше чтобы понять есть ли следующая страница
+	hits, err := h.Messages.SearchMessages(r.Context(), search)
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to search messages")
+		return
+	}
+
+	var nextOffset *int
+	if len(hits) > limit {
+		hits = hits[:limit]
+		n := offset + limit
+		nextOffset = &n
+	}
+
+	results := make([]searchResult, len(hits))
+	for i, hit := range hits {
+		results[i] = searchResult{
+			Message:   hit.Message,
+			ChatTitle: hit.ChatTitle,
+			Rank:      hit.Rank,
+			Snippet:   snippetHTML(hit.Snippet),
+		}
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Results    []searchResult `json:"results"`
+		NextOffset *int           `json:"next_offset"`
+	}{
+		Results:    results,
+		NextOffset: nextOffset,
+	})
+}
+
+// snippetHTML экранирует текст сообщения и только потом превращает метки совпадений в <mark>,
+// иначе html из сообщения попал бы в сниппет как есть
+func snippetHTML(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(store.MarkStart, searchMarkStart, store.MarkEnd, searchMarkEnd).Replace(escaped)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"chat-api/internal/metrics"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+	"chat-api/internal/store"
+)
+
+const (
+	// сколько ждем запись в сокет
+	socketWriteWait = 10 * time.Second
+	// сколько ждем pong от клиента
+	socketPongWait = 60 * time.Second
+	// как часто шлем ping, должно быть меньше pongWait
+	socketPingPeriod = socketPongWait * 9 / 10
+	// максимальный размер входящего сообщения
+	socketMaxMessageSize = 16 * 1024
+	// буфер событий на подписчика, при переполнении подписчик отключается
+	socketEventBuffer = 64
+)
+
+var upgrader = websocket.Upgrader{
+	HandshakeTimeout: socketWriteWait,
+	// авторизация по токену, а не по кукам, так что чужой origin не опасен
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketCommand входящее сообщение от клиента
+type socketCommand struct {
+	Type          string `json:"type"`
+	Text          string `json:"text"`
+	ParentID      *uint  `json:"parent_id"`
+	AttachmentIDs []uint `json:"attachment_ids"` // загруженные заранее по токену
+}
+
+// ChatSocket отдает события чата по вебсокету и принимает новые сообщения
+func (h *Handler) ChatSocket(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chatID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidID, "Invalid chat ID")
+		return
+	}
+	userID, _ := h.currentUserID(r)
+
+	chat, ok := h.loadChat(w, r, uint(chatID))
+	if !ok {
+		return
+	}
+	if _, ok := h.requireMember(w, r, chat.ID, userID); !ok {
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// ответ с ошибкой уже записан апгрейдером
+		return
+	}
+
+	h.Metrics.ConnectionOpened(metrics.TransportWebSocket)
+	defer h.Metrics.ConnectionClosed(metrics.TransportWebSocket)
+
+	sub := h.Hub.Subscribe(chat.ID, socketEventBuffer)
+	h.touchOnline(r.Context(), chat.ID, userID)
+	go h.socketWriter(conn, sub, userID)
+	h.socketReader(r.Context(), conn, sub, chat.ID, userID)
+}
+
+// socketReader читает команды клиента пока соединение живо, ctx запроса нужен для ид в логах
+func (h *Handler) socketReader(ctx context.Context, conn *websocket.Conn, sub *realtime.Subscriber, chatID, userID uint) {
+	defer func() {
+		h.Hub.Unsubscribe(sub)
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(socketMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		// pong приходит на каждый ping, заодно продлеваем онлайн
+		h.touchOnline(context.Background(), chatID, userID)
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		var cmd socketCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				h.logger(ctx).Warn("websocket read error", "chat_id", chatID, "user_id", userID, "error", err)
+			}
+			return
+		}
+
+		switch cmd.Type {
+		case "message.create":
+			// права проверяем на каждую команду, участника могли убрать после подключения
+			if err := h.checkSocketPublisher(chatID, userID); err != nil {
+				h.socketError(sub, problem.From(err, "Failed to check membership"))
+				continue
+			}
+			text, ok := validateMessageBody(cmd.Text, len(cmd.AttachmentIDs))
+			if !ok {
+				h.socketError(sub, errInvalidText)
+				continue
+			}
+			if cmd.ParentID != nil {
+				if err := h.checkParent(context.Background(), chatID, *cmd.ParentID); err != nil {
+					h.socketError(sub, problem.From(err, "Failed to create message"))
+					continue
+				}
+			}
+			// само сообщение придет всем подписчикам, включая отправителя, через хаб
+			if _, err := h.saveMessage(context.Background(), chatID, userID, text, cmd.ParentID, cmd.AttachmentIDs); err != nil {
+				h.socketError(sub, problem.From(err, "Failed to create message"))
+			}
+		default:
+			h.socketError(sub, problem.New(http.StatusBadRequest, problem.UnknownCommand, "Unknown command type"))
+		}
+	}
+}
+
+// checkSocketPublisher проверяет что пользователь все еще может писать в чат
+func (h *Handler) checkSocketPublisher(chatID, userID uint) error {
+	ctx := context.Background()
+	chat, err := h.Chats.Chat(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	member, err := h.Chats.Member(ctx, chatID, userID)
+	if errors.Is(err, store.ErrNotFound) {
+		return errNotMember
+	}
+	if err != nil {
+		return err
+	}
+	if !canPublish(chat, member) {
+		return errNotPublisher
+	}
+	return nil
+}
+
+// socketError отправляет ошибку только этому клиенту, с тем же кодом, что и в HTTP ответе
+func (h *Handler) socketError(sub *realtime.Subscriber, p *problem.Problem) {
+	data := map[string]interface{}{"code": p.Code, "message": p.Detail}
+	if len(p.Errors) > 0 {
+		data["errors"] = p.Errors
+	}
+	h.Hub.Send(sub, realtime.Event{Type: realtime.EventError, ChatID: sub.ChatID, Data: data})
+}
+
+// socketWriter единственный, кто пишет в соединение: события хаба и ping
+func (h *Handler) socketWriter(conn *websocket.Conn, sub *realtime.Subscriber, userID uint) {
+	ticker := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if !ok {
+				// хаб отключил медленного клиента, иначе читатель уже закрыл соединение
+				if sub.Dropped() {
+					conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber too slow"))
+				}
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+			// чата больше нет, слушать нечего
+			if event.Type == realtime.EventChatDeleted {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "chat deleted"))
+				return
+			}
+			// пользователя убрали из чата, дальше событий ему не положено
+			if event.Removes(userID) {
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "removed from chat"))
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/store"
+)
+
+// GetThread отдает корень ветки и страницу ответов, листается так же как GetChat
+// через before и after, ответы идут по возрастанию (created_at, id)
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	// у удаленного корня ветка все равно доступна
+	member, root, ok := h.chatMessage(w, r, true)
+	if !ok {
+		return
+	}
+	if root.ParentID != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.NotThreadRoot, "Message is not a thread root")
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			if l > 100 {
+				l = 100
+			}
+			limit = l
+		}
+	}
+
+	before, after := r.URL.Query().Get("before"), r.URL.Query().Get("after")
+	if before != "" && after != "" {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Only one of before, after is allowed")
+		return
+	}
+
+	timeline := store.Timeline{ChatID: root.ChatID, RootID: root.ID}
+
+	var pivot *models.Message
+	if cursor := before + after; cursor != "" {
+		id, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil || id == 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.InvalidCursor, "Invalid cursor")
+			return
+		}
+		pivot, err = h.Messages.Message(r.Context(), root.ChatID, uint(id), true)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load thread")
+			return
+		}
+		if err != nil || pivot.ParentID == nil || *pivot.ParentID != root.ID {
+			problem.Write(w, r, http.StatusNotFound, problem.CursorNotFound, "Cursor message not found")
+			return
+		}
+	}
+
+	var replies []models.Message
+	var hasOlder, hasNewer bool
+	var err error
+	if after != "" {
+		replies, hasNewer, err = h.Messages.After(r.Context(), timeline, pivot, limit)
+		hasOlder = true
+	} else {
+		replies, hasOlder, err = h.Messages.Before(r.Context(), timeline, pivot, limit)
+		hasNewer = pivot != nil
+	}
+	if err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load thread")
+		return
+	}
+	if replies == nil {
+		replies = []models.Message{}
+	}
+	// корень и ответы одним списком для реакций и вложений
+	all := append([]models.Message{*root}, replies...)
+	if err := h.attachReactions(r.Context(), all, member.UserID); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load thread")
+		return
+	}
+	if err := h.attachFiles(r.Context(), all); err != nil {
+		problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Failed to load thread")
+		return
+	}
+	root, replies = &all[0], all[1:]
+
+	var prevCursor, nextCursor *uint
+	if len(replies) > 0 {
+		if hasOlder {
+			prevCursor = &replies[0].ID
+		}
+		if hasNewer {
+			nextCursor = &replies[len(replies)-1].ID
+		}
+	}
+
+	json.NewEncoder(w).Encode(struct {
+		Root       *models.Message  `json:"root"`
+		Replies    []models.Message `json:"replies"`
+		PrevCursor *uint            `json:"prev_cursor"`
+		NextCursor *uint            `json:"next_cursor"`
+	}{
+		Root:       root,
+		Replies:    replies,
+		PrevCursor: prevCursor,
+		NextCursor: nextCursor,
+	})
+}
@@ -0,0 +1,308 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chat-api/internal/media"
+	"chat-api/internal/models"
+	"chat-api/internal/storage"
+)
+
+const (
+	// на столько задача захватывается воркером, после этого ее может взять другой
+	lease = 5 * time.Minute
+	// сколько задач выбирается из очереди за раз
+	batchSize = 10
+	// длина сохраняемого текста ошибки, как у колонки last_error
+	maxErrorLength = 1000
+)
+
+// вложение удалили или заменили пока шла обработка
+var errAttachmentGone = errors.New("attachment gone")
+
+// Worker разбирает очередь attachment_jobs: размеры, blurhash и превью картинок,
+// заодно вырезает GPS из EXIF. воркеров может быть несколько на одну базу,
+// задача захватывается условным UPDATE по счетчику попыток.
+// он же удаляет просроченные резервации вложений, файл для которых так и не загрузили
+type Worker struct {
+	DB          *gorm.DB
+	Blobs       storage.BlobStore
+	Sizes       []int         // размеры превью по большей стороне
+	Interval    time.Duration // как часто проверять очередь
+	MaxAttempts int
+	Backoff     time.Duration // пауза после первой неудачи, дальше удваивается
+	Logger      *slog.Logger  // nil - slog.Default()
+}
+
+func (w *Worker) logger() *slog.Logger {
+	if w.Logger == nil {
+		return slog.Default()
+	}
+	return w.Logger
+}
+
+// Enqueue ставит вложение в очередь, если его тип обрабатывается.
+// зовется в той же транзакции, что и сохранение загруженного файла
+func Enqueue(tx *gorm.DB, attachment *models.Attachment) error {
+	if !media.Supported(attachment.MimeType) {
+		return nil
+	}
+	now := time.Now()
+	return tx.Create(&models.AttachmentJob{
+		AttachmentID: attachment.ID,
+		Status:       models.JobPending,
+		RunAt:        now,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}).Error
+}
+
+// Run обрабатывает очередь пока не отменен ctx. текущая задача при отмене
+// прерывается и откладывается на повтор, Run возвращается после записи ее итога
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			w.logger().Error("attachment jobs", "error", err)
+		}
+		if _, err := w.SweepExpired(ctx); err != nil && ctx.Err() == nil {
+			w.logger().Error("attachment sweep", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce выполняет задачи, срок которых подошел, и возвращает сколько выполнено
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	processed := 0
+	for {
+		var jobs []models.AttachmentJob
+		err := w.DB.WithContext(ctx).Where("status = ? AND run_at <= ?", models.JobPending, time.Now()).
+			Order("run_at, id").Limit(batchSize).Find(&jobs).Error
+		if err != nil {
+			return processed, err
+		}
+
+		claimed := 0
+		for i := range jobs {
+			if err := ctx.Err(); err != nil {
+				return processed, err
+			}
+			ok, err := w.claim(ctx, &jobs[i])
+			if err != nil {
+				return processed, err
+			}
+			// задачу уже взял другой воркер
+			if !ok {
+				continue
+			}
+			claimed++
+			w.finish(&jobs[i], w.process(ctx, jobs[i].AttachmentID))
+			processed++
+		}
+		if claimed == 0 {
+			return processed, nil
+		}
+	}
+}
+
+// SweepExpired удаляет незагруженные вложения с истекшим сроком резервации
+// вместе с недописанным файлом и возвращает сколько удалено
+func (w *Worker) SweepExpired(ctx context.Context) (int, error) {
+	swept := 0
+	for {
+		var attachments []models.Attachment
+		err := w.DB.WithContext(ctx).Where("uploaded_at IS NULL AND expires_at <= ?", time.Now()).
+			Order("id").Limit(batchSize).Find(&attachments).Error
+		if err != nil {
+			return swept, err
+		}
+
+		for _, attachment := range attachments {
+			// загрузка могла завершиться прямо сейчас, тогда вложение остается
+			result := w.DB.WithContext(ctx).Where("id = ? AND uploaded_at IS NULL", attachment.ID).
+				Delete(&models.Attachment{})
+			if result.Error != nil {
+				return swept, result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			swept++
+			if attachment.StorageKey != "" {
+				w.deleteBlobs(attachment.StorageKey)
+			}
+		}
+		if len(attachments) < batchSize {
+			return swept, nil
+		}
+	}
+}
+
+// claim захватывает задачу: кто первым увеличил attempts, тот и выполняет
+func (w *Worker) claim(ctx context.Context, job *models.AttachmentJob) (bool, error) {
+	now := time.Now()
+	result := w.DB.WithContext(ctx).Model(&models.AttachmentJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, models.JobPending, job.Attempts).
+		Updates(map[string]interface{}{
+			"attempts":   job.Attempts + 1,
+			"run_at":     now.Add(lease),
+			"updated_at": now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	job.Attempts++
+	return result.RowsAffected == 1, nil
+}
+
+// finish записывает итог: битая картинка и исчерпанные попытки - failed,
+// остальные ошибки откладывают задачу на повтор
+func (w *Worker) finish(job *models.AttachmentJob, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{"updated_at": now}
+	switch {
+	case err == nil:
+		updates["status"] = models.JobDone
+		updates["last_error"] = ""
+	case errors.Is(err, media.ErrInvalidImage) || job.Attempts >= w.MaxAttempts:
+		updates["status"] = models.JobFailed
+		updates["last_error"] = truncate(err.Error())
+		w.logger().Error("attachment job failed", "job_id", job.ID, "attempt", job.Attempts, "error", err)
+	default:
+		updates["run_at"] = now.Add(w.Backoff << (job.Attempts - 1))
+		updates["last_error"] = truncate(err.Error())
+		w.logger().Warn("attachment job failed, will retry", "job_id", job.ID, "attempt", job.Attempts, "error", err)
+	}
+	// без контекста запроса: итог нужно записать и при остановке воркера
+	if err := w.DB.Model(&models.AttachmentJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		w.logger().Error("attachment job result not saved", "job_id", job.ID, "error", err)
+	}
+}
+
+// process строит превью и метаданные одного вложения
+func (w *Worker) process(ctx context.Context, attachmentID uint) error {
+	var attachment models.Attachment
+	err := w.DB.WithContext(ctx).Where("uploaded_at IS NOT NULL").First(&attachment, attachmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blob, err := w.Blobs.Open(ctx, attachment.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return err
+	}
+
+	result, err := media.Process(data, w.Sizes)
+	if err != nil {
+		return err
+	}
+
+	// ключи производные от исходного, повторная попытка перезапишет те же файлы
+	var keys []string
+	thumbnails := make([]models.AttachmentThumbnail, 0, len(result.Thumbnails))
+	for _, t := range result.Thumbnails {
+		key := fmt.Sprintf("%s_%d", attachment.StorageKey, t.Size)
+		if err := w.Blobs.Put(ctx, key, bytes.NewReader(t.Data), int64(len(t.Data)), media.ThumbnailMimeType); err != nil {
+			w.deleteBlobs(keys...)
+			return err
+		}
+		keys = append(keys, key)
+		thumbnails = append(thumbnails, models.AttachmentThumbnail{
+			AttachmentID: attachment.ID,
+			Size:         t.Size,
+			Width:        t.Width,
+			Height:       t.Height,
+			MimeType:     media.ThumbnailMimeType,
+			StorageKey:   key,
+		})
+	}
+
+	updates := map[string]interface{}{
+		"width":    result.Width,
+		"height":   result.Height,
+		"blurhash": result.Blurhash,
+	}
+	// исходник без GPS кладем рядом и подменяем ключ, старый файл удаляем после
+	if result.Cleaned != nil {
+		key := attachment.StorageKey + "_clean"
+		if err := w.Blobs.Put(ctx, key, bytes.NewReader(result.Cleaned), int64(len(result.Cleaned)), attachment.MimeType); err != nil {
+			w.deleteBlobs(keys...)
+			return err
+		}
+		keys = append(keys, key)
+		sum := sha256.Sum256(result.Cleaned)
+		updates["storage_key"] = key
+		updates["sha256"] = hex.EncodeToString(sum[:])
+	}
+
+	err = w.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(&models.Attachment{}).
+			Where("id = ? AND storage_key = ?", attachment.ID, attachment.StorageKey).
+			Updates(updates)
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errAttachmentGone
+		}
+		if err := tx.Where("attachment_id = ?", attachment.ID).Delete(&models.AttachmentThumbnail{}).Error; err != nil {
+			return err
+		}
+		if len(thumbnails) == 0 {
+			return nil
+		}
+		return tx.Create(&thumbnails).Error
+	})
+	if err != nil {
+		w.deleteBlobs(keys...)
+		if errors.Is(err, errAttachmentGone) {
+			return nil
+		}
+		return err
+	}
+	if result.Cleaned != nil {
+		w.deleteBlobs(attachment.StorageKey)
+	}
+	return nil
+}
+
+// deleteBlobs ошибки только в лог, осиротевший файл хуже не сделает
+func (w *Worker) deleteBlobs(keys ...string) {
+	for _, key := range keys {
+		if err := w.Blobs.Delete(context.Background(), key); err != nil {
+			w.logger().Warn("blob cleanup failed", "key", key, "error", err)
+		}
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
@@ -0,0 +1,152 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	tagOrientation = 0x0112
+	tagGPSInfo     = 0x8825
+	// запись IFD: тег, тип, количество и значение или смещение до него
+	ifdEntrySize = 12
+)
+
+// размеры значений по типам TIFF, неизвестные типы не трогаем
+var tiffTypeSizes = map[uint16]uint64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// readExif достает из EXIF в JPEG тег Orientation и затирает GPS. data не меняется:
+// если координаты были, возвращается копия файла без них того же размера
+func readExif(data []byte) (orientation int, cleaned []byte) {
+	orientation = 1
+	start, end, ok := jpegExif(data)
+	if !ok {
+		return orientation, nil
+	}
+	t, ok := newTIFF(data[start:end])
+	if !ok {
+		return orientation, nil
+	}
+
+	ifd0 := t.order.Uint32(t.data[4:])
+	n, ok := t.entries(ifd0)
+	if !ok {
+		return orientation, nil
+	}
+	var gps uint32
+	for i := 0; i < n; i++ {
+		e := int(ifd0) + 2 + i*ifdEntrySize
+		switch t.order.Uint16(t.data[e:]) {
+		case tagOrientation:
+			if t.order.Uint16(t.data[e+2:]) == 3 {
+				orientation = int(t.order.Uint16(t.data[e+8:]))
+			}
+		case tagGPSInfo:
+			gps = t.order.Uint32(t.data[e+8:])
+		}
+	}
+	if gps == 0 {
+		return orientation, nil
+	}
+
+	cleaned = bytes.Clone(data)
+	ct := tiff{data: cleaned[start:end], order: t.order}
+	if !ct.clearIFD(gps) {
+		return orientation, nil
+	}
+	return orientation, cleaned
+}
+
+// jpegExif границы TIFF данных из сегмента APP1 Exif
+func jpegExif(data []byte) (start, end int, ok bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, 0, false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 0, 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // заполнитель
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD8): // маркеры без длины
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9: // дальше сжатые данные, EXIF стоит раньше
+			return 0, 0, false
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		segmentEnd := i + 2 + length
+		if length < 2 || segmentEnd > len(data) {
+			return 0, 0, false
+		}
+		if marker == 0xE1 && bytes.HasPrefix(data[i+4:segmentEnd], []byte("Exif\x00\x00")) {
+			return i + 10, segmentEnd, true
+		}
+		i = segmentEnd
+	}
+	return 0, 0, false
+}
+
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func newTIFF(data []byte) (tiff, bool) {
+	if len(data) < 8 {
+		return tiff{}, false
+	}
+	t := tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return tiff{}, false
+	}
+	return t, t.order.Uint16(data[2:]) == 42
+}
+
+// entries количество записей IFD, если все они помещаются в данные
+func (t tiff) entries(offset uint32) (int, bool) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return 0, false
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	if uint64(offset)+2+uint64(n*ifdEntrySize) > uint64(len(t.data)) {
+		return 0, false
+	}
+	return n, true
+}
+
+// clearIFD затирает нулями значения и записи IFD. получается пустой IFD
+// без следующего, так что читатели EXIF видят пустой блок GPS
+func (t tiff) clearIFD(offset uint32) bool {
+	n, ok := t.entries(offset)
+	if !ok || n == 0 {
+		return false
+	}
+	for i := 0; i < n; i++ {
+		e := int(offset) + 2 + i*ifdEntrySize
+		size := tiffTypeSizes[t.order.Uint16(t.data[e+2:])] * uint64(t.order.Uint32(t.data[e+4:]))
+		// до 4 байт значение лежит прямо в записи
+		if size > 4 {
+			at := uint64(t.order.Uint32(t.data[e+8:]))
+			if at+size <= uint64(len(t.data)) {
+				clear(t.data[at : at+size])
+			}
+		}
+	}
+	end := int(offset) + 2 + n*ifdEntrySize + 4
+	if end > len(t.data) {
+		end -= 4
+	}
+	clear(t.data[offset:end])
+	return true
+}
@@ -0,0 +1,165 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // регистрация декодеров для image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"mime"
+	"sort"
+
+	"github.com/buckket/go-blurhash"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// ThumbnailMimeType превью всегда jpeg, прозрачность заливается белым
+	ThumbnailMimeType = "image/jpeg"
+	thumbnailQuality  = 80
+	// картинки больше стольких пикселей не декодируем, защита от сжатых бомб
+	maxPixels = 50_000_000
+	// blurhash считается по уменьшенной копии, на полном размере это долго
+	blurhashSource = 32
+)
+
+// ErrInvalidImage файл не декодируется или слишком большой, повторять обработку бессмысленно
+var ErrInvalidImage = errors.New("invalid image")
+
+// Supported типы вложений, для которых строятся превью
+func Supported(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+type Thumbnail struct {
+	Size   int // ограничение на большую сторону
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Result метаданные картинки, размеры уже с учетом поворота из EXIF
+type Result struct {
+	Width      int
+	Height     int
+	Blurhash   string
+	Thumbnails []Thumbnail
+	// Cleaned исходник с вырезанным GPS, nil если вырезать было нечего
+	Cleaned []byte
+}
+
+// Process декодирует картинку и строит превью для каждого размера из sizes.
+// превью не больше исходника: для маленькой картинки часть размеров пропускается
+func Process(data []byte, sizes []int) (*Result, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	orientation, cleaned := readExif(data)
+	result := &Result{Width: cfg.Width, Height: cfg.Height, Cleaned: cleaned}
+	if orientation >= 5 {
+		result.Width, result.Height = cfg.Height, cfg.Width
+	}
+
+	// от большего к меньшему, каждое следующее превью уменьшается из предыдущего
+	sorted := append([]int(nil), sizes...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	src := img
+	for i, size := range sorted {
+		if size <= 0 || (i > 0 && size == sorted[i-1]) || size >= max(cfg.Width, cfg.Height) {
+			continue
+		}
+		scaled := scale(src, size)
+		src = scaled
+
+		// поворачиваем уже уменьшенную копию, так дешевле
+		oriented := orient(scaled, orientation)
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, oriented, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+			return nil, err
+		}
+		b := oriented.Bounds()
+		result.Thumbnails = append(result.Thumbnails, Thumbnail{Size: size, Width: b.Dx(), Height: b.Dy(), Data: buf.Bytes()})
+	}
+	// наружу по возрастанию размера
+	sort.Slice(result.Thumbnails, func(i, j int) bool { return result.Thumbnails[i].Size < result.Thumbnails[j].Size })
+
+	result.Blurhash, err = blurhash.Encode(4, 3, orient(scale(src, blurhashSource), orientation))
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scale вписывает картинку в квадрат size x size с сохранением пропорций
+func scale(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, b, xdraw.Over, nil)
+	return dst
+}
+
+// orient применяет поворот и отражение по тегу Orientation из EXIF (1..8)
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // отражение по горизонтали
+				dx, dy = w-1-x, y
+			case 3: // поворот на 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // отражение по вертикали
+				dx, dy = x, h-1-y
+			case 5: // транспонирование
+				dx, dy = y, x
+			case 6: // поворот на 90 по часовой
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8: // поворот на 90 против часовой
+				dx, dy = y, w-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
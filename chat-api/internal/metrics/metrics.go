@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// виды соединений реального времени
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// Metrics счетчики сервера для Prometheus. все методы работают и на nil,
+// тогда метрики просто не собираются
+type Metrics struct {
+	registry     *prometheus.Registry
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	messages     prometheus.Counter
+	chatsCreated *prometheus.CounterVec
+	chatsDeleted prometheus.Counter
+	connections  *prometheus.GaugeVec
+}
+
+// New регистрирует метрики в своем реестре, db - пул базы для go_sql_* метрик, может быть nil
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chat_api_http_requests_total",
+			Help: "HTTP requests by route template, method and status.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chat_api_http_request_duration_seconds",
+			Help:    "HTTP request latency by route template and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		messages: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_api_messages_created_total",
+			Help: "Messages created.",
+		}),
+		chatsCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chat_api_chats_created_total",
+			Help: "Chats created by type.",
+		}, []string{"type"}),
+		chatsDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chat_api_chats_deleted_total",
+			Help: "Chats deleted.",
+		}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "chat_api_realtime_connections",
+			Help: "Open real-time connections by transport.",
+		}, []string{"transport"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests, m.latency, m.messages, m.chatsCreated, m.chatsDeleted, m.connections,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "chat"))
+	}
+	// чтобы нулевые значения были видны до первого соединения
+	m.connections.WithLabelValues(TransportWebSocket)
+	m.connections.WithLabelValues(TransportSSE)
+	return m
+}
+
+// Handler отдает метрики в текстовом формате Prometheus
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest учитывает запрос, route - шаблон маршрута, а не путь, иначе ряды плодятся на каждый ид
+func (m *Metrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	m.latency.WithLabelValues(route, method).Observe(elapsed.Seconds())
+}
+
+func (m *Metrics) MessageCreated() {
+	if m == nil {
+		return
+	}
+	m.messages.Inc()
+}
+
+func (m *Metrics) ChatCreated(chatType string) {
+	if m == nil {
+		return
+	}
+	m.chatsCreated.WithLabelValues(chatType).Inc()
+}
+
+func (m *Metrics) ChatDeleted() {
+	if m == nil {
+		return
+	}
+	m.chatsDeleted.Inc()
+}
+
+// ConnectionOpened отмечает открытое соединение, вызывающий закрывает его через ConnectionClosed
+func (m *Metrics) ConnectionOpened(transport string) {
+	if m == nil {
+		return
+	}
+	m.connections.WithLabelValues(transport).Inc()
+}
+
+func (m *Metrics) ConnectionClosed(transport string) {
+	if m == nil {
+		return
+	}
+	m.connections.WithLabelValues(transport).Dec()
+}
@@ -1,16 +1,187 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
 	"net/http"
 	"time"
+
+	"github.com/gorilla/mux"
+
+	"chat-api/internal/auth"
+	"chat-api/internal/metrics"
+	"chat-api/internal/problem"
+	"chat-api/internal/requestid"
 )
 
-func Logging(next http.Handler) http.Handler {
+// Logging пишет по строке на запрос: статус, размер ответа, время и шаблон маршрута.
+// оборачивает весь роутер после RequestID, чтобы в лог попадали и 404/405 мимо маршрутов,
+// шаблон маршрута ему сообщает Route изнутри роутера
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			r, route := withRoute(r)
+			next.ServeHTTP(rec, r)
+
+			level := slog.LevelInfo
+			if rec.Status() >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			// без query, там может быть access_token
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("request_id", requestid.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route.String()),
+				slog.Int("status", rec.Status()),
+				slog.Int64("bytes", rec.bytes),
+				slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remote_ip", remoteIP(r)),
+			)
+		})
+	}
+}
+
+// Metrics считает запросы и их время по шаблону маршрута
+func Metrics(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			r, route := withRoute(r)
+			next.ServeHTTP(rec, r)
+			m.ObserveRequest(route.String(), metricMethod(r.Method), rec.Status(), time.Since(start))
+		})
+	}
+}
+
+// OtherMethod метка для нестандартных методов: мимо маршрутов клиент может прислать любой
+const OtherMethod = "other"
+
+// metricMethod метод для метки, чтобы случайные строки не плодили ряды
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return method
+	}
+	return OtherMethod
+}
+
+// UnmatchedRoute шаблон для запросов, не попавших ни в один маршрут
+const UnmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// matchedRoute шаблон маршрута вместо пути, чтобы запросы к разным чатам группировались.
+// mux знает маршрут только внутри роутера, поэтому Route записывает его сюда для оберток снаружи
+type matchedRoute struct {
+	template string
+}
+
+func (m *matchedRoute) String() string {
+	if m.template == "" {
+		return UnmatchedRoute
+	}
+	return m.template
+}
+
+// withRoute кладет в контекст место под шаблон маршрута, если внешняя обертка его еще не положила
+func withRoute(r *http.Request) (*http.Request, *matchedRoute) {
+	if route, ok := r.Context().Value(routeKey{}).(*matchedRoute); ok {
+		return r, route
+	}
+	route := &matchedRoute{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, route)), route
+}
+
+// Route ставится в роутер первым через Use и сообщает шаблон найденного маршрута в Logging и Metrics
+func Route(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		if route, ok := r.Context().Value(routeKey{}).(*matchedRoute); ok {
+			if current := mux.CurrentRoute(r); current != nil {
+				route.template, _ = current.GetPathTemplate()
+			}
+		}
 		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+	})
+}
+
+// statusRecorder запоминает статус и размер ответа. Flush, Hijack и Unwrap
+// пробрасываются дальше, без них не работают SSE и вебсокеты
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Status код ответа, 200 если обработчик ничего не записал
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+func (rec *statusRecorder) Flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Hijack забирает соединение под вебсокет, ответ дальше пишет уже не сервер
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// remoteIP адрес клиента без порта
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestID берет ид запроса у прокси из X-Request-ID или создает новый,
+// отдает его в ответе и кладет в контекст, по нему ошибка клиента находится в логах
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		next.ServeHTTP(w, r.WithContext(requestid.WithID(r.Context(), id)))
 	})
 }
 
@@ -20,3 +191,30 @@ func JSONContentType(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// Auth пропускает только запросы с валидным bearer токеном и кладет ид пользователя в контекст
+func Auth(issuer *auth.Issuer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := auth.BearerToken(r.Header.Get("Authorization"))
+			// браузер не умеет ставить заголовки при открытии вебсокета
+			if token == "" {
+				token = r.URL.Query().Get("access_token")
+			}
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Unauthorized")
+				return
+			}
+
+			userID, err := issuer.Parse(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				problem.Write(w, r, http.StatusUnauthorized, problem.Unauthorized, "Unauthorized")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
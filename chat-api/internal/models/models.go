@@ -1,19 +1,207 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// типы чатов
+const (
+	ChatGroup   = "group"
+	ChatDirect  = "direct"
+	ChatChannel = "channel" // пишут только владелец и админы, остальные подписчики читают
 )
 
+// Chat групповой чат с названием, канал или личный чат двух пользователей без названия.
+// у личного чата пара участников хранится упорядоченной (DirectUser1ID < DirectUser2ID),
+// уникальный индекс по ней не дает завести второй чат той же паре.
+// MemberCount двигается вместе с составом в одной транзакции, чтобы не считать участников на каждый запрос
 type Chat struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Title     string    `gorm:"size:200;not null" json:"title"`
-	CreatedAt time.Time `json:"created_at"`
-	Messages  []Message `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"messages,omitempty"`
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Type           string    `gorm:"size:20;not null;default:group" json:"type"`
+	Title          string    `gorm:"size:200;not null" json:"title"`
+	DirectUser1ID  *uint     `gorm:"uniqueIndex:idx_chats_direct_pair" json:"-"`
+	DirectUser2ID  *uint     `gorm:"uniqueIndex:idx_chats_direct_pair" json:"-"`
+	MemberCount    int       `gorm:"not null;default:0" json:"member_count"`
+	CreatedAt      time.Time `json:"created_at"`
+	LastActivityAt time.Time `gorm:"index" json:"last_activity_at"`
+	Messages       []Message `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"messages,omitempty"`
 }
 
 type Message struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	ChatID      uint           `gorm:"not null" json:"chat_id"`
+	AuthorID    *uint          `gorm:"index" json:"author_id"`
+	ParentID    *uint          `gorm:"index" json:"parent_id"` // корень ветки, у корня ведется счетчик ответов
+	ReplyCount  int            `gorm:"not null;default:0" json:"reply_count"`
+	LastReplyAt *time.Time     `json:"last_reply_at"`
+	Text        string         `gorm:"size:5000;not null" json:"text"`
+	CreatedAt   time.Time      `json:"created_at"`
+	EditedAt    *time.Time     `json:"edited_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	// сводка реакций и вложения, заполняются при выдаче истории
+	Reactions   []ReactionCount `gorm:"-" json:"reactions,omitempty"`
+	Attachments []Attachment    `gorm:"-" json:"attachments,omitempty"`
+}
+
+// MarshalJSON отдает удаленное сообщение заглушкой без текста и автора,
+// чтобы клиент показал "сообщение удалено" на его месте в истории
+func (m Message) MarshalJSON() ([]byte, error) {
+	if m.DeletedAt.Valid {
+		// у удаленного корня ветка остается, поэтому счетчики ответов отдаем
+		return json.Marshal(struct {
+			ID          uint       `json:"id"`
+			ChatID      uint       `json:"chat_id"`
+			ParentID    *uint      `json:"parent_id"`
+			ReplyCount  int        `json:"reply_count"`
+			LastReplyAt *time.Time `json:"last_reply_at"`
+			CreatedAt   time.Time  `json:"created_at"`
+			Deleted     bool       `json:"deleted"`
+		}{
+			ID:          m.ID,
+			ChatID:      m.ChatID,
+			ParentID:    m.ParentID,
+			ReplyCount:  m.ReplyCount,
+			LastReplyAt: m.LastReplyAt,
+			CreatedAt:   m.CreatedAt,
+			Deleted:     true,
+		})
+	}
+	type plain Message
+	return json.Marshal(plain(m))
+}
+
+// MessageRevision прежняя версия текста сообщения, CreatedAt - когда эта версия была написана
+type MessageRevision struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	ChatID    uint      `gorm:"not null" json:"chat_id"`
+	MessageID uint      `gorm:"not null;index" json:"message_id"`
 	Text      string    `gorm:"size:5000;not null" json:"text"`
 	CreatedAt time.Time `json:"created_at"`
+	Message   *Message  `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// Attachment метаданные файла, само содержимое в хранилище под StorageKey.
+// до отправки сообщения MessageID пустой, загрузка по токену заполняет UploadedAt,
+// незагруженная резервация удаляется воркером после ExpiresAt.
+// размеры, blurhash и превью картинок появляются после фоновой обработки
+type Attachment struct {
+	ID         uint                  `gorm:"primaryKey" json:"id"`
+	ChatID     uint                  `gorm:"not null;index" json:"chat_id"`
+	MessageID  *uint                 `gorm:"index" json:"message_id"`
+	UploaderID *uint                 `gorm:"index" json:"uploader_id"`
+	Filename   string                `gorm:"size:255;not null" json:"filename"`
+	MimeType   string                `gorm:"size:255;not null" json:"mime_type"`
+	Size       int64                 `gorm:"not null" json:"size"`
+	SHA256     string                `gorm:"column:sha256;size:64" json:"sha256"`
+	StorageKey string                `gorm:"size:255" json:"-"`
+	UploadedAt *time.Time            `json:"-"`
+	ExpiresAt  *time.Time            `gorm:"index" json:"-"`
+	CreatedAt  time.Time             `json:"created_at"`
+	Width      *int                  `json:"width,omitempty"`
+	Height     *int                  `json:"height,omitempty"`
+	Blurhash   *string               `gorm:"size:100" json:"blurhash,omitempty"`
+	Thumbnails []AttachmentThumbnail `gorm:"foreignKey:AttachmentID;constraint:OnDelete:CASCADE;" json:"thumbnails,omitempty"`
+	Chat       *Chat                 `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"-"`
+	Message    *Message              `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;" json:"-"`
+	Uploader   *User                 `gorm:"foreignKey:UploaderID;constraint:OnDelete:SET NULL;" json:"-"`
+}
+
+// AttachmentThumbnail уменьшенная копия картинки, Size - ограничение на большую сторону.
+// отдается по GET /attachments/{id}/thumbnails/{size}
+type AttachmentThumbnail struct {
+	AttachmentID uint   `gorm:"primaryKey" json:"-"`
+	Size         int    `gorm:"primaryKey" json:"size"`
+	Width        int    `gorm:"not null" json:"width"`
+	Height       int    `gorm:"not null" json:"height"`
+	MimeType     string `gorm:"size:255;not null" json:"mime_type"`
+	StorageKey   string `gorm:"size:255;not null" json:"-"`
+}
+
+// статусы фоновых задач
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// AttachmentJob задача фоновой обработки вложения. взятая в работу задача остается
+// pending, а RunAt сдвигается на время аренды: если воркер упадет, ее возьмут снова
+type AttachmentJob struct {
+	ID           uint        `gorm:"primaryKey" json:"id"`
+	AttachmentID uint        `gorm:"not null;uniqueIndex" json:"attachment_id"`
+	Status       string      `gorm:"size:20;not null;index:idx_attachment_jobs_due,priority:1" json:"status"`
+	Attempts     int         `gorm:"not null;default:0" json:"attempts"`
+	RunAt        time.Time   `gorm:"not null;index:idx_attachment_jobs_due,priority:2" json:"run_at"`
+	LastError    string      `gorm:"size:1000" json:"last_error"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	Attachment   *Attachment `gorm:"foreignKey:AttachmentID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"size:50;not null;uniqueIndex" json:"username"`
+	PasswordHash string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// роли участников чата
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+type ChatMember struct {
+	ChatID    uint      `gorm:"primaryKey" json:"chat_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	Role      string    `gorm:"size:20;not null" json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// ид последнего прочитанного сообщения, nil если чат еще не открывали
+	LastReadMessageID *uint `json:"last_read_message_id"`
+	User              *User `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"user,omitempty"`
+	Chat              *Chat `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+type MessageReaction struct {
+	MessageID uint      `gorm:"primaryKey" json:"message_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	Emoji     string    `gorm:"primaryKey;size:64" json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+	Message   *Message  `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;" json:"-"`
+	User      *User     `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// MessageMention упоминание участника в сообщении, Everyone - упомянут через @all.
+// ReadAt ставится при чтении во входящих или когда прочитан чат до этого сообщения
+type MessageMention struct {
+	MessageID uint       `gorm:"primaryKey;index:idx_message_mentions_inbox,priority:2" json:"message_id"`
+	UserID    uint       `gorm:"primaryKey;index:idx_message_mentions_inbox,priority:1" json:"user_id"`
+	ChatID    uint       `gorm:"not null;index" json:"chat_id"`
+	Everyone  bool       `gorm:"not null;default:false" json:"everyone"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	Message   *Message   `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;" json:"-"`
+	User      *User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"-"`
+	Chat      *Chat      `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"-"`
+}
+
+// MessagePin закрепленное сообщение чата, при удалении сообщения открепляется
+type MessagePin struct {
+	ChatID    uint      `gorm:"primaryKey" json:"chat_id"`
+	MessageID uint      `gorm:"primaryKey;index" json:"message_id"`
+	PinnedBy  *uint     `json:"pinned_by"`
+	CreatedAt time.Time `json:"pinned_at"`
+	Chat      *Chat     `gorm:"foreignKey:ChatID;constraint:OnDelete:CASCADE;" json:"-"`
+	Message   *Message  `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE;" json:"message,omitempty"`
+	User      *User     `gorm:"foreignKey:PinnedBy;constraint:OnDelete:SET NULL;" json:"-"`
+}
+
+// ReactionCount сколько раз поставлена реакция и есть ли среди них реакция текущего пользователя
+type ReactionCount struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	Me    bool   `json:"me"`
 }
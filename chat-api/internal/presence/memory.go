@@ -0,0 +1,72 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryKey struct {
+	kind   Kind
+	chatID uint
+}
+
+// MemoryStore хранилище в памяти процесса, подходит когда сервер один
+type MemoryStore struct {
+	mu sync.Mutex
+	// срок жизни отметки по пользователю
+	expires map[memoryKey]map[uint]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{expires: make(map[memoryKey]map[uint]time.Time)}
+}
+
+func (s *MemoryStore) Touch(ctx context.Context, kind Kind, chatID, userID uint, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey{kind, chatID}
+	users := s.expires[key]
+	if users == nil {
+		users = make(map[uint]time.Time)
+		s.expires[key] = users
+	}
+	users[userID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) Clear(ctx context.Context, kind Kind, chatID, userID uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memoryKey{kind, chatID}
+	delete(s.expires[key], userID)
+	if len(s.expires[key]) == 0 {
+		delete(s.expires, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Users(ctx context.Context, kind Kind, chatID uint) ([]uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// заодно вычищаем протухшие отметки
+	key := memoryKey{kind, chatID}
+	now := time.Now()
+	users := []uint{}
+	for userID, expires := range s.expires[key] {
+		if now.Before(expires) {
+			users = append(users, userID)
+		} else {
+			delete(s.expires[key], userID)
+		}
+	}
+	if len(s.expires[key]) == 0 {
+		delete(s.expires, key)
+	}
+
+	sortUsers(users)
+	return users, nil
+}
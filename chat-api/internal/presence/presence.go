@@ -0,0 +1,45 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Kind вид эфемерного состояния участника чата
+type Kind string
+
+const (
+	Typing Kind = "typing"
+	Online Kind = "online"
+)
+
+// Store хранит кто печатает и кто онлайн в чатах. Отметки живут ttl
+// и пропадают сами, в базу ничего не пишется
+type Store interface {
+	// Touch ставит или продлевает отметку пользователя в чате
+	Touch(ctx context.Context, kind Kind, chatID, userID uint, ttl time.Duration) error
+	// Clear снимает отметку раньше срока
+	Clear(ctx context.Context, kind Kind, chatID, userID uint) error
+	// Users пользователи с живой отметкой по возрастанию ид
+	Users(ctx context.Context, kind Kind, chatID uint) ([]uint, error)
+}
+
+// New выбирает хранилище: redis по адресу вида redis://host:6379/0, без адреса память
+func New(redisURL string) (Store, error) {
+	if redisURL == "" {
+		return NewMemoryStore(), nil
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid presence redis url: %w", err)
+	}
+	return NewRedisStore(redis.NewClient(opts)), nil
+}
+
+func sortUsers(users []uint) {
+	sort.Slice(users, func(i, j int) bool { return users[i] < users[j] })
+}
@@ -0,0 +1,67 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore общее хранилище для нескольких серверов. На чат и вид отметки один
+// sorted set: участник - ид пользователя, score - когда отметка истекает в мс
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func redisKey(kind Kind, chatID uint) string {
+	return fmt.Sprintf("presence:%s:%d", kind, chatID)
+}
+
+func (s *RedisStore) Touch(ctx context.Context, kind Kind, chatID, userID uint, ttl time.Duration) error {
+	key := redisKey(kind, chatID)
+	expires := time.Now().Add(ttl).UnixMilli()
+
+	// ключ целиком живет не дольше последней отметки, брошенные чаты не копятся
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(expires), Member: userID})
+		pipe.PExpire(ctx, key, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) Clear(ctx context.Context, kind Kind, chatID, userID uint) error {
+	return s.client.ZRem(ctx, redisKey(kind, chatID), userID).Err()
+}
+
+func (s *RedisStore) Users(ctx context.Context, kind Kind, chatID uint) ([]uint, error) {
+	key := redisKey(kind, chatID)
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+
+	var members *redis.StringSliceCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", now)
+		members = pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + now, Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := []uint{}
+	for _, member := range members.Val() {
+		id, err := strconv.ParseUint(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		users = append(users, uint(id))
+	}
+	sortUsers(users)
+	return users, nil
+}
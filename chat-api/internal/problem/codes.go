@@ -0,0 +1,59 @@
+package problem
+
+// коды ошибок в поле code. это часть API: значения не меняются, новые только добавляются
+const (
+	// общие
+	Internal         = "internal_error"
+	Unauthorized     = "unauthorized"
+	InvalidBody      = "invalid_body"
+	InvalidID        = "invalid_id"
+	InvalidCursor    = "invalid_cursor"
+	ValidationFailed = "validation_failed"
+	RouteNotFound    = "route_not_found"
+	MethodNotAllowed = "method_not_allowed"
+
+	// не найдено
+	ChatNotFound       = "chat_not_found"
+	MessageNotFound    = "message_not_found"
+	ParentNotFound     = "parent_not_found"
+	CursorNotFound     = "cursor_not_found"
+	UserNotFound       = "user_not_found"
+	MemberNotFound     = "member_not_found"
+	AttachmentNotFound = "attachment_not_found"
+	ThumbnailNotFound  = "thumbnail_not_found"
+	NotPinned          = "not_pinned"
+
+	// нет прав
+	InvalidCredentials   = "invalid_credentials"
+	InvalidUploadToken   = "invalid_upload_token"
+	NotMember            = "not_a_member"
+	InsufficientRole     = "insufficient_role"
+	NotAuthor            = "not_author"
+	NotPublisher         = "not_publisher"
+	DirectChatFixed      = "direct_chat_members_fixed"
+	OwnerCannotBeRemoved = "owner_cannot_be_removed"
+
+	// конфликты и прочие отказы
+	UsernameTaken         = "username_taken"
+	AlreadyMember         = "already_member"
+	AlreadyUploaded       = "attachment_already_uploaded"
+	AttachmentUnavailable = "attachment_unavailable"
+	PinLimitReached       = "pin_limit_reached"
+	FileTooLarge          = "file_too_large"
+	SizeMismatch          = "size_mismatch"
+	NestedReply           = "nested_reply"
+	NotThreadRoot         = "not_thread_root"
+	NotChannel            = "not_a_channel"
+	DirectChatWithSelf    = "direct_chat_with_self"
+	MentionNotMember      = "mention_not_member"
+	UnknownCommand        = "unknown_command"
+)
+
+// коды FieldError.Code
+const (
+	FieldRequired = "required"
+	FieldLength   = "length"
+	FieldFormat   = "format"
+	FieldInvalid  = "invalid"
+	FieldTooMany  = "too_many"
+)
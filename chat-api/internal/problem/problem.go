@@ -0,0 +1,85 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"chat-api/internal/requestid"
+)
+
+// ContentType ответы с ошибками по RFC 7807
+const ContentType = "application/problem+json"
+
+// Problem тело ответа с ошибкой. клиенты разбирают Code, Detail только для людей и может меняться.
+// Problem еще и error, так что его можно вернуть из вспомогательной функции и записать выше
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Code      string       `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+// FieldError ошибка в одном поле запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail}
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Send пишет ответ с ошибкой, дополняя его адресом и ид запроса
+func Send(w http.ResponseWriter, r *http.Request, p *Problem) {
+	body := *p
+	body.Type = "about:blank"
+	body.Title = http.StatusText(p.Status)
+	body.Instance = r.URL.Path
+	body.RequestID = requestid.FromContext(r.Context())
+
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	// заголовки отдачи файла к ошибке не относятся
+	h.Del("Content-Length")
+	h.Del("Content-Disposition")
+	h.Del("ETag")
+	h.Del("Last-Modified")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// Write ответ с ошибкой без полей
+func Write(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Send(w, r, New(status, code, detail))
+}
+
+// From достает Problem из цепочки err, остальные ошибки - 500 с detail,
+// чтобы подробности сбоя не уходили клиенту
+func From(err error, detail string) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	return New(http.StatusInternalServerError, Internal, detail)
+}
+
+// Invalid 400 с ошибками полей запроса, detail - сообщение первой из них
+func Invalid(w http.ResponseWriter, r *http.Request, errs ...FieldError) {
+	Send(w, r, &Problem{
+		Status: http.StatusBadRequest,
+		Code:   ValidationFailed,
+		Detail: errs[0].Message,
+		Errors: errs,
+	})
+}
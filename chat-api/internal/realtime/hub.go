@@ -0,0 +1,133 @@
+package realtime
+
+import (
+	"sync"
+)
+
+// типы событий для подписчиков чата
+const (
+	EventMessageCreated  = "message.created"
+	EventMessageUpdated  = "message.updated"
+	EventMessageDeleted  = "message.deleted"
+	EventChatDeleted     = "chat.deleted"
+	EventReactionAdded   = "reaction.added"
+	EventReactionRemoved = "reaction.removed"
+	EventMessagePinned   = "message.pinned"
+	EventMessageUnpinned = "message.unpinned"
+	EventReadUpdated     = "read.updated"
+	EventMemberRemoved   = "member.removed"
+	EventTyping          = "typing"
+	EventError           = "error"
+)
+
+type Event struct {
+	Type   string `json:"type"`
+	ChatID uint   `json:"chat_id"`
+	// ид сообщения для событий message.created, по нему SSE клиент докачивает пропущенное
+	ID uint `json:"-"`
+	// ид пользователя для member.removed, его соединения с чатом закрываются
+	UserID uint        `json:"-"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// Removes true если событие исключает пользователя из чата
+func (e Event) Removes(userID uint) bool {
+	return e.Type == EventMemberRemoved && e.UserID == userID
+}
+
+// Subscriber получает события одного чата через буферизованный канал.
+// Если подписчик не успевает читать и буфер полон, хаб его отключает и закрывает канал
+type Subscriber struct {
+	ChatID  uint
+	events  chan Event
+	closed  bool
+	dropped bool
+}
+
+// Events канал событий, закрывается при отписке или отключении медленного подписчика
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped true если хаб отключил подписчика за переполнение буфера,
+// читать можно после закрытия канала Events
+func (s *Subscriber) Dropped() bool {
+	return s.dropped
+}
+
+// Hub раздает события подписчикам по чатам
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[*Subscriber]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[uint]map[*Subscriber]struct{})}
+}
+
+func (h *Hub) Subscribe(chatID uint, buffer int) *Subscriber {
+	s := &Subscriber{ChatID: chatID, events: make(chan Event, buffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[chatID] == nil {
+		h.subscribers[chatID] = make(map[*Subscriber]struct{})
+	}
+	h.subscribers[chatID][s] = struct{}{}
+	return s
+}
+
+// Unsubscribe можно звать повторно и после отключения хабом
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.remove(s, false)
+}
+
+// Publish не блокируется: кто не успевает, тот отключается
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subscribers[e.ChatID] {
+		h.deliver(s, e)
+	}
+}
+
+// Send отправляет событие одному подписчику, например ошибку на его команду
+func (h *Hub) Send(s *Subscriber, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !s.closed {
+		h.deliver(s, e)
+	}
+}
+
+func (h *Hub) deliver(s *Subscriber, e Event) {
+	select {
+	case s.events <- e:
+	default:
+		h.remove(s, true)
+	}
+}
+
+// Subscribers количество подписчиков чата
+func (h *Hub) Subscribers(chatID uint) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers[chatID])
+}
+
+func (h *Hub) remove(s *Subscriber, dropped bool) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.dropped = dropped
+	close(s.events)
+
+	subs := h.subscribers[s.ChatID]
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.subscribers, s.ChatID)
+	}
+}
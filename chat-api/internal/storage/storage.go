@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"chat-api/internal/config"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore хранилище содержимого вложений, в базе лежат только метаданные и ключ
+type BlobStore interface {
+	// Put сохраняет ровно size байт из r под ключом
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open открывает содержимое с поддержкой Seek, чтобы отдавать диапазоны
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete удаляет содержимое, отсутствующий ключ не ошибка
+	Delete(ctx context.Context, key string) error
+}
+
+// New выбирает хранилище по BLOB_STORE: local (каталог на диске) или s3
+func New(cfg *config.Config) (BlobStore, error) {
+	switch cfg.BlobStore {
+	case "", "local":
+		return NewLocal(cfg.BlobDir)
+	case "s3":
+		return NewS3FromConfig(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unsupported blob store %q", cfg.BlobStore)
+	}
+}
@@ -0,0 +1,439 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chat-api/internal/models"
+)
+
+// GormStore хранилище поверх базы, реализует Store.
+// диалект влияет только на поиск: tsvector в postgres, fts4 в sqlite
+type GormStore struct {
+	db *gorm.DB
+}
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// notFound сводит ошибку gorm об отсутствии записи к ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// uniqueViolation нарушен уникальный индекс: 23505 в postgres, текст ошибки в sqlite
+func uniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (s *GormStore) User(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *GormStore) UserByName(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *GormStore) UsersByNames(ctx context.Context, usernames []string) ([]models.User, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+	var users []models.User
+	err := s.db.WithContext(ctx).Where("username IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
+func (s *GormStore) CreateUser(ctx context.Context, user *models.User) error {
+	// проверка заранее не спасет от параллельной регистрации, так что решает уникальный индекс
+	err := s.db.WithContext(ctx).Create(user).Error
+	if uniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *GormStore) Chat(ctx context.Context, id uint) (*models.Chat, error) {
+	var chat models.Chat
+	if err := s.db.WithContext(ctx).First(&chat, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &chat, nil
+}
+
+func (s *GormStore) DirectChat(ctx context.Context, user1ID, user2ID uint) (*models.Chat, error) {
+	var chat models.Chat
+	err := s.db.WithContext(ctx).
+		Where("type = ? AND direct_user1_id = ? AND direct_user2_id = ?", models.ChatDirect, user1ID, user2ID).
+		First(&chat).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &chat, nil
+}
+
+// непрочитанные считаются по ленте чата: живые корневые сообщения новее позиции
+// чтения, кроме своих. ид растут вместе с (created_at, id), так что хватает сравнения ид.
+// условие ждет в запросе присоединенную строку chat_members читателя
+const unreadCondition = "messages.deleted_at IS NULL AND messages.parent_id IS NULL" +
+	" AND messages.id > COALESCE(chat_members.last_read_message_id, 0)" +
+	" AND (messages.author_id IS NULL OR messages.author_id <> chat_members.user_id)"
+
+// escapeLike экранирует спецсимволы LIKE, чтобы префикс искался буквально
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (s *GormStore) ListChats(ctx context.Context, query ChatListQuery) ([]ChatSummary, error) {
+	q := s.db.WithContext(ctx).Table("chats").
+		Select("chats.*, (SELECT COUNT(*) FROM messages WHERE messages.chat_id = chats.id AND messages.deleted_at IS NULL AND messages.parent_id IS NULL) AS message_count, "+
+			"chat_members.last_read_message_id, "+
+			"(SELECT COUNT(*) FROM messages WHERE messages.chat_id = chats.id AND "+unreadCondition+") AS unread_count, "+
+			"(SELECT MIN(messages.id) FROM messages WHERE messages.chat_id = chats.id AND "+unreadCondition+") AS first_unread_id").
+		Joins("JOIN chat_members ON chat_members.chat_id = chats.id AND chat_members.user_id = ?", query.UserID)
+
+	if query.Prefix != "" {
+		q = q.Where(`LOWER(chats.title) LIKE ? ESCAPE '\'`, strings.ToLower(escapeLike(query.Prefix))+"%")
+	}
+	if c := query.Cursor; c != nil {
+		q = q.Where("chats.last_activity_at < ? OR (chats.last_activity_at = ? AND chats.id < ?)",
+			c.LastActivityAt, c.LastActivityAt, c.ID)
+	}
+
+	var chats []ChatSummary
+	err := q.Order("chats.last_activity_at DESC, chats.id DESC").Limit(query.Limit).Scan(&chats).Error
+	return chats, err
+}
+
+func (s *GormStore) DeleteChat(ctx context.Context, id uint) ([]string, error) {
+	db := s.db.WithContext(ctx)
+	// файлы вложений каскад не удалит, запоминаем ключи до удаления строк
+	keys, err := blobKeys(db, db.Model(&models.Attachment{}).Select("id").Where("chat_id = ?", id))
+	if err != nil {
+		return nil, err
+	}
+	//(сообщения и участники удалятся каскадно из-за constraint)
+	if err := db.Delete(&models.Chat{}, id).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// blobKeys ключи содержимого вложений из подзапроса ids вместе с их превью.
+// каскад удалит строки, а файлы нет, поэтому ключи собираются до удаления
+func blobKeys(db *gorm.DB, ids *gorm.DB) ([]string, error) {
+	var keys, thumbnails []string
+	if err := db.Model(&models.Attachment{}).Where("id IN (?)", ids).Pluck("storage_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.AttachmentThumbnail{}).Where("attachment_id IN (?)", ids).Pluck("storage_key", &thumbnails).Error; err != nil {
+		return nil, err
+	}
+	return append(keys, thumbnails...), nil
+}
+
+func (s *GormStore) Member(ctx context.Context, chatID, userID uint) (*models.ChatMember, error) {
+	var member models.ChatMember
+	if err := s.db.WithContext(ctx).Where("chat_id = ? AND user_id = ?", chatID, userID).First(&member).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &member, nil
+}
+
+func (s *GormStore) Members(ctx context.Context, chatID uint) ([]models.ChatMember, error) {
+	var members []models.ChatMember
+	err := s.db.WithContext(ctx).Preload("User").Where("chat_id = ?", chatID).Order("created_at, user_id").Find(&members).Error
+	return members, err
+}
+
+func (s *GormStore) MemberIDs(ctx context.Context, chatID uint, userIDs []uint) ([]uint, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	var ids []uint
+	err := s.db.WithContext(ctx).Model(&models.ChatMember{}).
+		Where("chat_id = ? AND user_id IN ?", chatID, userIDs).Pluck("user_id", &ids).Error
+	return ids, err
+}
+
+func (s *GormStore) AddMember(ctx context.Context, member *models.ChatMember) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(member)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		return changeMemberCount(tx, member.ChatID, 1)
+	})
+}
+
+func (s *GormStore) RemoveMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	removed := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("chat_id = ? AND user_id = ?", chatID, userID).Delete(&models.ChatMember{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		removed = true
+		return changeMemberCount(tx, chatID, -1)
+	})
+	return removed, err
+}
+
+// changeMemberCount двигает счетчик участников чата, вызывается в той же транзакции,
+// что и изменение состава, иначе счетчик разойдется с chat_members
+func changeMemberCount(tx *gorm.DB, chatID uint, delta int) error {
+	return tx.Model(&models.Chat{}).Where("id = ?", chatID).
+		Update("member_count", gorm.Expr("member_count + ?", delta)).Error
+}
+
+func (s *GormStore) Unread(ctx context.Context, chatID, userID uint) (Unread, error) {
+	var unread Unread
+	err := s.db.WithContext(ctx).Model(&models.Message{}).
+		Select("COUNT(*) AS unread_count, MIN(messages.id) AS first_unread_id").
+		Joins("JOIN chat_members ON chat_members.chat_id = messages.chat_id AND chat_members.user_id = ?", userID).
+		Where("messages.chat_id = ?", chatID).
+		Where(unreadCondition).
+		Scan(&unread).Error
+	return unread, err
+}
+
+func (s *GormStore) MarkRead(ctx context.Context, chatID, userID, messageID uint) (bool, error) {
+	moved := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// упоминания в прочитанной части ленты тоже прочитаны, ответы в ветках нет
+		err := tx.Model(&models.MessageMention{}).
+			Where("chat_id = ? AND user_id = ? AND read_at IS NULL AND message_id <= ?", chatID, userID, messageID).
+			Where("message_id IN (?)", tx.Unscoped().Model(&models.Message{}).Select("id").Where("chat_id = ? AND parent_id IS NULL", chatID)).
+			Update("read_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+
+		// позиция только растет, старый запрос с другого устройства ее не откатит
+		result := tx.Model(&models.ChatMember{}).
+			Where("chat_id = ? AND user_id = ?", chatID, userID).
+			Where("last_read_message_id IS NULL OR last_read_message_id < ?", messageID).
+			Update("last_read_message_id", messageID)
+		moved = result.RowsAffected > 0
+		return result.Error
+	})
+	return moved, err
+}
+
+func (s *GormStore) CreateChat(ctx context.Context, chat *models.Chat, members []models.ChatMember) error {
+	chat.MemberCount = len(members)
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(chat).Error; err != nil {
+			return err
+		}
+		for i := range members {
+			members[i].ChatID = chat.ID
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+func (s *GormStore) Message(ctx context.Context, chatID, id uint, withDeleted bool) (*models.Message, error) {
+	q := s.db.WithContext(ctx)
+	if withDeleted {
+		q = q.Unscoped()
+	}
+
+	var message models.Message
+	if err := q.Where("chat_id = ? AND id = ?", chatID, id).First(&message).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &message, nil
+}
+
+// timeline запрос ленты вместе с заглушками удаленных, поэтому без фильтра deleted_at
+func (s *GormStore) timeline(ctx context.Context, t Timeline) *gorm.DB {
+	q := s.db.WithContext(ctx).Unscoped().Where("chat_id = ?", t.ChatID)
+	if t.RootID == 0 {
+		return q.Where("parent_id IS NULL")
+	}
+	return q.Where("parent_id = ?", t.RootID)
+}
+
+func (s *GormStore) Before(ctx context.Context, t Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error) {
+	q := s.timeline(ctx, t)
+	if pivot != nil {
+		q = q.Where("created_at < ? OR (created_at = ? AND id < ?)", pivot.CreatedAt, pivot.CreatedAt, pivot.ID)
+	}
+
+	var messages []models.Message
+	if err := q.Order("created_at DESC, id DESC").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	//порядок для правильной сортировки
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, hasMore, nil
+}
+
+func (s *GormStore) After(ctx context.Context, t Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error) {
+	var messages []models.Message
+	err := s.timeline(ctx, t).
+		Where("created_at > ? OR (created_at = ? AND id > ?)", pivot.CreatedAt, pivot.CreatedAt, pivot.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit + 1).
+		Find(&messages).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	return messages, hasMore, nil
+}
+
+func (s *GormStore) MessagesByID(ctx context.Context, ids []uint) ([]models.Message, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	var messages []models.Message
+	err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+func (s *GormStore) MessagesAfterID(ctx context.Context, chatID, afterID uint, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.WithContext(ctx).Where("chat_id = ? AND id > ?", chatID, afterID).
+		Order("id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+func (s *GormStore) LastMessageID(ctx context.Context, chatID uint) (uint, error) {
+	var lastID *uint
+	err := s.db.WithContext(ctx).Unscoped().Model(&models.Message{}).Where("chat_id = ?", chatID).Select("MAX(id)").Scan(&lastID).Error
+	if err != nil || lastID == nil {
+		return 0, err
+	}
+	return *lastID, nil
+}
+
+// LastMessages одним запросом на все чаты
+func (s *GormStore) LastMessages(ctx context.Context, chatIDs []uint) ([]models.Message, error) {
+	if len(chatIDs) == 0 {
+		return nil, nil
+	}
+	db := s.db.WithContext(ctx)
+	var messages []models.Message
+	err := db.Where("id IN (?)",
+		db.Model(&models.Message{}).Select("MAX(id)").Where("chat_id IN ?", chatIDs).Group("chat_id"),
+	).Find(&messages).Error
+	return messages, err
+}
+
+// searchRow строка выдачи, Message встроен только для сканирования
+type searchRow struct {
+	models.Message
+	ChatTitle string
+	Rank      float64
+	Snippet   string
+}
+
+func (s *GormStore) SearchMessages(ctx context.Context, query SearchQuery) ([]SearchHit, error) {
+	// только живые сообщения из чатов где пользователь участник
+	q := s.searchQuery(ctx, query.Text).
+		Joins("JOIN chats ON chats.id = messages.chat_id").
+		Joins("JOIN chat_members ON chat_members.chat_id = messages.chat_id AND chat_members.user_id = ?", query.UserID).
+		Where("messages.deleted_at IS NULL")
+	if query.ChatID != 0 {
+		q = q.Where("messages.chat_id = ?", query.ChatID)
+	}
+	if query.AuthorID != 0 {
+		q = q.Where("messages.author_id = ?", query.AuthorID)
+	}
+	if query.From != nil {
+		q = q.Where("messages.created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		q = q.Where("messages.created_at < ?", *query.To)
+	}
+
+	var rows []searchRow
+	err := q.Order("rank DESC, messages.created_at DESC, messages.id DESC").
+		Offset(query.Offset).
+		Limit(query.Limit).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, len(rows))
+	for i, row := range rows {
+		hits[i] = SearchHit{Message: row.Message, ChatTitle: row.ChatTitle, Rank: row.Rank, Snippet: row.Snippet}
+	}
+	return hits, nil
+}
+
+// searchQuery полнотекстовое совпадение с рангом и сниппетом.
+// в postgres индекс tsvector из миграции 010, в sqlite (тесты) таблица fts4 messages_fts
+func (s *GormStore) searchQuery(ctx context.Context, text string) *gorm.DB {
+	db := s.db.WithContext(ctx)
+	if db.Dialector.Name() == "sqlite" {
+		// ранг - сколько раз слова запроса встретились в тексте, offsets дает по 4 числа на совпадение
+		return db.Table("messages").
+			Select("messages.*, chats.title AS chat_title, "+
+				"(LENGTH(offsets(messages_fts)) - LENGTH(REPLACE(offsets(messages_fts), ' ', '')) + 1) / 4 AS rank, "+
+				"snippet(messages_fts, ?, ?, '…', -1, 15) AS snippet", MarkStart, MarkEnd).
+			Joins("JOIN messages_fts ON messages_fts.docid = messages.id").
+			Where("messages_fts MATCH ?", ftsQuery(text))
+	}
+
+	headline := `StartSel="` + MarkStart + `", StopSel="` + MarkEnd + `", MaxWords=30, MinWords=10, MaxFragments=2`
+	return db.Table("messages").
+		Select("messages.*, chats.title AS chat_title, "+
+			"ts_rank(messages.search_vector, websearch_to_tsquery('russian', ?)) AS rank, "+
+			"ts_headline('russian', messages.text, websearch_to_tsquery('russian', ?), ?) AS snippet", text, text, headline).
+		Where("messages.search_vector @@ websearch_to_tsquery('russian', ?)", text)
+}
+
+// ftsQuery превращает ввод пользователя в запрос fts: каждое слово в кавычках,
+// чтобы операторы и спецсимволы искались как текст. стемминга в fts4 нет,
+// поэтому слова ищутся по префиксу
+func ftsQuery(text string) string {
+	words := strings.Fields(strings.ReplaceAll(text, `"`, " "))
+	for i, word := range words {
+		words[i] = `"` + word + `*"`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"chat-api/internal/jobs"
+	"chat-api/internal/models"
+)
+
+func (s *GormStore) Attachment(ctx context.Context, id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := s.db.WithContext(ctx).First(&attachment, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &attachment, nil
+}
+
+func (s *GormStore) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attachment).Error; err != nil {
+			return err
+		}
+		if attachment.UploadedAt == nil {
+			return nil
+		}
+		return jobs.Enqueue(tx, attachment)
+	})
+}
+
+func (s *GormStore) BeginUpload(ctx context.Context, id uint, key string) error {
+	result := s.db.WithContext(ctx).Model(&models.Attachment{}).
+		Where("id = ? AND uploaded_at IS NULL", id).
+		Update("storage_key", key)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *GormStore) CompleteUpload(ctx context.Context, attachment *models.Attachment) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// две параллельные загрузки по одному токену: выигрывает первая
+		result := tx.Model(&models.Attachment{}).
+			Where("id = ? AND uploaded_at IS NULL", attachment.ID).
+			Updates(map[string]interface{}{
+				"sha256":      attachment.SHA256,
+				"storage_key": attachment.StorageKey,
+				"uploaded_at": attachment.UploadedAt,
+				"expires_at":  nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrConflict
+		}
+		// превью картинок строятся в фоне, ответ их не ждет
+		return jobs.Enqueue(tx, attachment)
+	})
+}
+
+func (s *GormStore) DeleteAttachment(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Delete(&models.Attachment{}, id).Error
+}
+
+func (s *GormStore) MessageAttachments(ctx context.Context, messageIDs []uint) ([]models.Attachment, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+	var attachments []models.Attachment
+	err := s.db.WithContext(ctx).Preload("Thumbnails", func(db *gorm.DB) *gorm.DB { return db.Order("size") }).
+		Where("message_id IN ?", messageIDs).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+func (s *GormStore) Thumbnail(ctx context.Context, attachmentID uint, size int) (*models.AttachmentThumbnail, error) {
+	var thumbnail models.AttachmentThumbnail
+	if err := s.db.WithContext(ctx).Where("attachment_id = ? AND size = ?", attachmentID, size).First(&thumbnail).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &thumbnail, nil
+}
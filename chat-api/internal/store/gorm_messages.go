@@ -0,0 +1,294 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"chat-api/internal/models"
+)
+
+// одним INSERT много упоминаний не вставить: у postgres предел 65535 параметров
+const mentionBatchSize = 1000
+
+func (s *GormStore) CreateMessage(ctx context.Context, message *models.Message, attachmentIDs []uint, mentions []models.MessageMention, mentionAll bool) error {
+	// вместе с сообщением двигаем активность чата для сортировки списка
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		if len(attachmentIDs) > 0 {
+			if err := linkAttachments(tx, message, attachmentIDs); err != nil {
+				return err
+			}
+		}
+		if len(mentions) > 0 {
+			for i := range mentions {
+				mentions[i].MessageID = message.ID
+			}
+			if err := tx.CreateInBatches(&mentions, mentionBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		// остальных участников выбирает сама база, уже упомянутые по имени пропускаются
+		if mentionAll {
+			var authorID uint
+			if message.AuthorID != nil {
+				authorID = *message.AuthorID
+			}
+			err := tx.Exec(`INSERT INTO message_mentions (message_id, user_id, chat_id, everyone, created_at)
+				SELECT ?, user_id, chat_id, ?, ? FROM chat_members WHERE chat_id = ? AND user_id <> ?
+				ON CONFLICT DO NOTHING`,
+				message.ID, true, message.CreatedAt, message.ChatID, authorID).Error
+			if err != nil {
+				return err
+			}
+		}
+		// счетчик ответов и время последнего ответа храним на корне ветки
+		if message.ParentID != nil {
+			err := tx.Model(&models.Message{}).Where("id = ?", *message.ParentID).Updates(map[string]interface{}{
+				"reply_count":   gorm.Expr("reply_count + 1"),
+				"last_reply_at": message.CreatedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.Chat{}).Where("id = ?", message.ChatID).
+			Update("last_activity_at", message.CreatedAt).Error
+	})
+}
+
+// linkAttachments привязывает загруженные автором и еще свободные вложения к сообщению
+func linkAttachments(tx *gorm.DB, message *models.Message, ids []uint) error {
+	unique := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		unique[id] = true
+	}
+
+	result := tx.Model(&models.Attachment{}).
+		Where("id IN ? AND chat_id = ? AND uploader_id = ?", ids, message.ChatID, *message.AuthorID).
+		Where("message_id IS NULL AND uploaded_at IS NOT NULL").
+		Update("message_id", message.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(unique)) {
+		return ErrAttachmentUnavailable
+	}
+	return tx.Where("message_id = ?", message.ID).Order("id").Find(&message.Attachments).Error
+}
+
+func (s *GormStore) EditMessage(ctx context.Context, message *models.Message, text string, editedAt time.Time) error {
+	// прежняя версия написана при создании или при прошлой правке
+	versionAt := message.CreatedAt
+	if message.EditedAt != nil {
+		versionAt = *message.EditedAt
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		revision := models.MessageRevision{
+			MessageID: message.ID,
+			Text:      message.Text,
+			CreatedAt: versionAt,
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		return tx.Model(message).Updates(map[string]interface{}{"text": text, "edited_at": editedAt}).Error
+	})
+	if err != nil {
+		return err
+	}
+	message.Text = text
+	message.EditedAt = &editedAt
+	return nil
+}
+
+func (s *GormStore) Revisions(ctx context.Context, messageID uint) ([]models.MessageRevision, error) {
+	var revisions []models.MessageRevision
+	err := s.db.WithContext(ctx).Where("message_id = ?", messageID).Order("created_at, id").Find(&revisions).Error
+	return revisions, err
+}
+
+func (s *GormStore) DeleteMessage(ctx context.Context, message *models.Message) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessagePin{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(message).Error
+	})
+}
+
+// PurgeMessage ревизии, реакции и остальное удаляются каскадно
+func (s *GormStore) PurgeMessage(ctx context.Context, message *models.Message) ([]string, error) {
+	db := s.db.WithContext(ctx)
+	// файлы вложений сообщения и его ответов удаляет вызывающий после строк
+	keys, err := blobKeys(db, db.Model(&models.Attachment{}).Select("id").
+		Where("message_id = ? OR message_id IN (?)", message.ID, db.Unscoped().Model(&models.Message{}).Select("id").Where("parent_id = ?", message.ID)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if message.ParentID == nil {
+			if err := tx.Unscoped().Where("parent_id = ?", message.ID).Delete(&models.Message{}).Error; err != nil {
+				return err
+			}
+		} else {
+			err := tx.Unscoped().Model(&models.Message{}).Where("id = ? AND reply_count > 0", *message.ParentID).
+				Update("reply_count", gorm.Expr("reply_count - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Delete(message).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *GormStore) AddReaction(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	result := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *GormStore) RemoveReaction(ctx context.Context, messageID, userID uint, emoji string) (bool, error) {
+	result := s.db.WithContext(ctx).Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.MessageReaction{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Reactions одним запросом на все сообщения
+func (s *GormStore) Reactions(ctx context.Context, messageIDs []uint, userID uint) (map[uint][]models.ReactionCount, error) {
+	byMessage := make(map[uint][]models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	var rows []struct {
+		MessageID uint
+		Emoji     string
+		Count     int
+		Me        int
+	}
+	err := s.db.WithContext(ctx).Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END) AS me", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(created_at), emoji").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		byMessage[row.MessageID] = append(byMessage[row.MessageID], models.ReactionCount{
+			Emoji: row.Emoji,
+			Count: row.Count,
+			Me:    row.Me == 1,
+		})
+	}
+	return byMessage, nil
+}
+
+func (s *GormStore) PinMessage(ctx context.Context, pin *models.MessagePin, limit int) (bool, error) {
+	created := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// строка чата заблокирована до конца транзакции, так что параллельные закрепления
+		// в одном чате идут по очереди и подсчет ниже видит уже вставленные.
+		// в sqlite FOR UPDATE нет, там запись в базу и так одна за раз
+		var chat models.Chat
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&chat, pin.ChatID).Error; err != nil {
+			return notFound(err)
+		}
+
+		var saved models.MessagePin
+		err := tx.Where("chat_id = ? AND message_id = ?", pin.ChatID, pin.MessageID).First(&saved).Error
+		if err == nil {
+			*pin = saved
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.MessagePin{}).Where("chat_id = ?", pin.ChatID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= int64(limit) {
+			return ErrLimit
+		}
+		if err := tx.Create(pin).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+func (s *GormStore) UnpinMessage(ctx context.Context, chatID, messageID uint) (bool, error) {
+	result := s.db.WithContext(ctx).Where("chat_id = ? AND message_id = ?", chatID, messageID).Delete(&models.MessagePin{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (s *GormStore) Pins(ctx context.Context, chatID uint) ([]models.MessagePin, error) {
+	var pins []models.MessagePin
+	err := s.db.WithContext(ctx).Preload("Message").Where("chat_id = ?", chatID).Order("created_at DESC, message_id DESC").Find(&pins).Error
+	return pins, err
+}
+
+func (s *GormStore) PinnedIDs(ctx context.Context, chatID uint) ([]uint, error) {
+	ids := []uint{}
+	err := s.db.WithContext(ctx).Model(&models.MessagePin{}).Where("chat_id = ?", chatID).
+		Order("created_at DESC, message_id DESC").Pluck("message_id", &ids).Error
+	return ids, err
+}
+
+// mentions упоминания пользователя в живых сообщениях чатов, где он все еще участник
+func (s *GormStore) mentions(ctx context.Context, userID uint) *gorm.DB {
+	return s.db.WithContext(ctx).Table("message_mentions").
+		Joins("JOIN messages ON messages.id = message_mentions.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN chat_members ON chat_members.chat_id = message_mentions.chat_id AND chat_members.user_id = message_mentions.user_id").
+		Where("message_mentions.user_id = ?", userID)
+}
+
+func (s *GormStore) Mentions(ctx context.Context, query MentionQuery) ([]MentionHit, error) {
+	q := s.mentions(ctx, query.UserID).
+		Select("message_mentions.*, chats.title AS chat_title").
+		Joins("JOIN chats ON chats.id = message_mentions.chat_id")
+	if query.ChatID != 0 {
+		q = q.Where("message_mentions.chat_id = ?", query.ChatID)
+	}
+	if query.Unread {
+		q = q.Where("message_mentions.read_at IS NULL")
+	}
+	if query.Before != 0 {
+		q = q.Where("message_mentions.message_id < ?", query.Before)
+	}
+
+	var hits []MentionHit
+	err := q.Order("message_mentions.message_id DESC").Limit(query.Limit).Scan(&hits).Error
+	return hits, err
+}
+
+func (s *GormStore) UnreadMentions(ctx context.Context, userID uint) (int64, error) {
+	var unread int64
+	err := s.mentions(ctx, userID).Where("message_mentions.read_at IS NULL").Count(&unread).Error
+	return unread, err
+}
+
+func (s *GormStore) MarkMentionsRead(ctx context.Context, userID uint, messageIDs []uint) error {
+	q := s.db.WithContext(ctx).Model(&models.MessageMention{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if len(messageIDs) > 0 {
+		q = q.Where("message_id IN ?", messageIDs)
+	}
+	return q.Update("read_at", time.Now()).Error
+}
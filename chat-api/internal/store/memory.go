@@ -0,0 +1,643 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"chat-api/internal/models"
+)
+
+type memberKey struct {
+	chatID uint
+	userID uint
+}
+
+type reactionKey struct {
+	messageID uint
+	userID    uint
+	emoji     string
+}
+
+type mentionKey struct {
+	messageID uint
+	userID    uint
+}
+
+// MemoryStore хранилище в памяти процесса, реализует Store.
+// нужно для тестов обработчиков без базы, отдает копии, так что снаружи его не изменить.
+// каскадные удаления базы повторяет сам, очереди фоновой обработки вложений нет
+type MemoryStore struct {
+	mu          sync.RWMutex
+	nextID      uint
+	users       map[uint]models.User
+	chats       map[uint]models.Chat
+	members     map[memberKey]models.ChatMember
+	messages    map[uint]models.Message
+	revisions   map[uint][]models.MessageRevision // по ид сообщения
+	reactions   map[reactionKey]models.MessageReaction
+	pins        map[uint]models.MessagePin // по ид сообщения, оно всегда в одном чате
+	mentions    map[mentionKey]models.MessageMention
+	attachments map[uint]models.Attachment
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:       make(map[uint]models.User),
+		chats:       make(map[uint]models.Chat),
+		members:     make(map[memberKey]models.ChatMember),
+		messages:    make(map[uint]models.Message),
+		revisions:   make(map[uint][]models.MessageRevision),
+		reactions:   make(map[reactionKey]models.MessageReaction),
+		pins:        make(map[uint]models.MessagePin),
+		mentions:    make(map[mentionKey]models.MessageMention),
+		attachments: make(map[uint]models.Attachment),
+	}
+}
+
+// newID ид для новой записи, один счетчик на все таблицы. зовется под блокировкой
+func (s *MemoryStore) newID() uint {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *MemoryStore) User(ctx context.Context, id uint) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) UserByName(ctx context.Context, username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) UsersByNames(ctx context.Context, usernames []string) ([]models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[string]bool, len(usernames))
+	for _, name := range usernames {
+		wanted[name] = true
+	}
+	var users []models.User
+	for _, user := range s.users {
+		if wanted[user.Username] {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return ErrConflict
+		}
+	}
+	user.ID = s.newID()
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *MemoryStore) Chat(ctx context.Context, id uint) (*models.Chat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	chat, ok := s.chats[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &chat, nil
+}
+
+func (s *MemoryStore) DirectChat(ctx context.Context, user1ID, user2ID uint) (*models.Chat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if chat, ok := s.directChat(user1ID, user2ID); ok {
+		return &chat, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) directChat(user1ID, user2ID uint) (models.Chat, bool) {
+	for _, chat := range s.chats {
+		if chat.Type == models.ChatDirect && chat.DirectUser1ID != nil && chat.DirectUser2ID != nil &&
+			*chat.DirectUser1ID == user1ID && *chat.DirectUser2ID == user2ID {
+			return chat, true
+		}
+	}
+	return models.Chat{}, false
+}
+
+func (s *MemoryStore) ListChats(ctx context.Context, query ChatListQuery) ([]ChatSummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix := strings.ToLower(query.Prefix)
+	var chats []ChatSummary
+	for key, member := range s.members {
+		if key.userID != query.UserID {
+			continue
+		}
+		chat := s.chats[key.chatID]
+		if !strings.HasPrefix(strings.ToLower(chat.Title), prefix) {
+			continue
+		}
+		if c := query.Cursor; c != nil &&
+			!(chat.LastActivityAt.Before(c.LastActivityAt) || (chat.LastActivityAt.Equal(c.LastActivityAt) && chat.ID < c.ID)) {
+			continue
+		}
+
+		summary := ChatSummary{Chat: chat, LastReadMessageID: member.LastReadMessageID, Unread: s.unread(member)}
+		for _, m := range s.messages {
+			if m.ChatID == chat.ID && !m.DeletedAt.Valid && m.ParentID == nil {
+				summary.MessageCount++
+			}
+		}
+		chats = append(chats, summary)
+	}
+
+	sort.Slice(chats, func(i, j int) bool {
+		a, b := &chats[i].Chat, &chats[j].Chat
+		if !a.LastActivityAt.Equal(b.LastActivityAt) {
+			return a.LastActivityAt.After(b.LastActivityAt)
+		}
+		return a.ID > b.ID
+	})
+	if len(chats) > query.Limit {
+		chats = chats[:query.Limit]
+	}
+	return chats, nil
+}
+
+// CreateChat второй личный чат той же паре не заводит, как уникальный индекс в базе
+func (s *MemoryStore) CreateChat(ctx context.Context, chat *models.Chat, members []models.ChatMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chat.Type == models.ChatDirect && chat.DirectUser1ID != nil && chat.DirectUser2ID != nil {
+		if _, ok := s.directChat(*chat.DirectUser1ID, *chat.DirectUser2ID); ok {
+			return ErrConflict
+		}
+	}
+
+	// как default в схеме
+	if chat.Type == "" {
+		chat.Type = models.ChatGroup
+	}
+	chat.ID = s.newID()
+	chat.MemberCount = len(members)
+	s.chats[chat.ID] = *chat
+	for i := range members {
+		members[i].ChatID = chat.ID
+		s.members[memberKey{chat.ID, members[i].UserID}] = members[i]
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteChat(ctx context.Context, id uint) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for _, a := range s.attachments {
+		if a.ChatID == id {
+			keys = append(keys, s.deleteAttachment(a.ID)...)
+		}
+	}
+	for _, m := range s.messages {
+		if m.ChatID == id {
+			s.deleteMessage(m.ID)
+		}
+	}
+	for key := range s.members {
+		if key.chatID == id {
+			delete(s.members, key)
+		}
+	}
+	delete(s.chats, id)
+	return keys, nil
+}
+
+// AddChat сохраняет чат как есть, например с нужным временем активности, для наполнения в тестах
+func (s *MemoryStore) AddChat(chat *models.Chat) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if chat.ID == 0 {
+		chat.ID = s.newID()
+	}
+	s.chats[chat.ID] = *chat
+}
+
+func (s *MemoryStore) Member(ctx context.Context, chatID, userID uint) (*models.ChatMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.members[memberKey{chatID, userID}]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &member, nil
+}
+
+func (s *MemoryStore) MemberIDs(ctx context.Context, chatID uint, userIDs []uint) ([]uint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []uint
+	for _, id := range userIDs {
+		if _, ok := s.members[memberKey{chatID, id}]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) Members(ctx context.Context, chatID uint) ([]models.ChatMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var members []models.ChatMember
+	for key, member := range s.members {
+		if key.chatID != chatID {
+			continue
+		}
+		if user, ok := s.users[key.userID]; ok {
+			member.User = &user
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+	return members, nil
+}
+
+func (s *MemoryStore) AddMember(ctx context.Context, member *models.ChatMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memberKey{member.ChatID, member.UserID}
+	if _, ok := s.members[key]; ok {
+		return ErrConflict
+	}
+	stored := *member
+	stored.User, stored.Chat = nil, nil
+	s.members[key] = stored
+	s.changeMemberCount(member.ChatID, 1)
+	return nil
+}
+
+func (s *MemoryStore) RemoveMember(ctx context.Context, chatID, userID uint) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := memberKey{chatID, userID}
+	if _, ok := s.members[key]; !ok {
+		return false, nil
+	}
+	delete(s.members, key)
+	s.changeMemberCount(chatID, -1)
+	return true, nil
+}
+
+func (s *MemoryStore) changeMemberCount(chatID uint, delta int) {
+	if chat, ok := s.chats[chatID]; ok {
+		chat.MemberCount += delta
+		s.chats[chatID] = chat
+	}
+}
+
+func (s *MemoryStore) Unread(ctx context.Context, chatID, userID uint) (Unread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	member, ok := s.members[memberKey{chatID, userID}]
+	if !ok {
+		return Unread{}, nil
+	}
+	return s.unread(member), nil
+}
+
+// unread по тем же правилам, что unreadCondition в GormStore
+func (s *MemoryStore) unread(member models.ChatMember) Unread {
+	var lastRead uint
+	if member.LastReadMessageID != nil {
+		lastRead = *member.LastReadMessageID
+	}
+
+	var unread Unread
+	for _, m := range s.messages {
+		if m.ChatID != member.ChatID || m.DeletedAt.Valid || m.ParentID != nil || m.ID <= lastRead {
+			continue
+		}
+		if m.AuthorID != nil && *m.AuthorID == member.UserID {
+			continue
+		}
+		unread.Count++
+		if unread.FirstID == nil || m.ID < *unread.FirstID {
+			id := m.ID
+			unread.FirstID = &id
+		}
+	}
+	return unread
+}
+
+func (s *MemoryStore) MarkRead(ctx context.Context, chatID, userID, messageID uint) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// упоминания в прочитанной части ленты тоже прочитаны, ответы в ветках нет
+	now := time.Now()
+	for key, mention := range s.mentions {
+		if mention.ChatID != chatID || key.userID != userID || mention.ReadAt != nil || key.messageID > messageID {
+			continue
+		}
+		if m, ok := s.messages[key.messageID]; ok && m.ParentID == nil {
+			mention.ReadAt = &now
+			s.mentions[key] = mention
+		}
+	}
+
+	key := memberKey{chatID, userID}
+	member, ok := s.members[key]
+	if !ok || (member.LastReadMessageID != nil && *member.LastReadMessageID >= messageID) {
+		return false, nil
+	}
+	member.LastReadMessageID = &messageID
+	s.members[key] = member
+	return true, nil
+}
+
+// AddMessage сохраняет сообщение как есть, пустой ид назначается сам. для наполнения в тестах
+func (s *MemoryStore) AddMessage(message *models.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message.ID == 0 {
+		message.ID = s.newID()
+	}
+	s.messages[message.ID] = stored(*message)
+}
+
+// stored сообщение без сводок, которые заполняются только при выдаче
+func stored(message models.Message) models.Message {
+	message.Reactions, message.Attachments = nil, nil
+	return message
+}
+
+func (s *MemoryStore) Message(ctx context.Context, chatID, id uint, withDeleted bool) (*models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	message, ok := s.messages[id]
+	if !ok || message.ChatID != chatID || (message.DeletedAt.Valid && !withDeleted) {
+		return nil, ErrNotFound
+	}
+	return &message, nil
+}
+
+// timeline сообщения ленты по возрастанию (created_at, id)
+func (s *MemoryStore) timeline(t Timeline) []models.Message {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range s.messages {
+		if m.ChatID != t.ChatID {
+			continue
+		}
+		if (t.RootID == 0 && m.ParentID == nil) || (t.RootID != 0 && m.ParentID != nil && *m.ParentID == t.RootID) {
+			messages = append(messages, m)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return less(&messages[i], &messages[j]) })
+	return messages
+}
+
+// less порядок сообщений в ленте, id разводит одинаковые времена
+func less(a, b *models.Message) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID < b.ID
+}
+
+func (s *MemoryStore) Before(ctx context.Context, t Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error) {
+	messages := s.timeline(t)
+	end := len(messages)
+	if pivot != nil {
+		end = sort.Search(len(messages), func(i int) bool { return !less(&messages[i], pivot) })
+	}
+
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+	if start == end {
+		return nil, start > 0, nil
+	}
+	return messages[start:end], start > 0, nil
+}
+
+func (s *MemoryStore) After(ctx context.Context, t Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error) {
+	messages := s.timeline(t)
+	start := sort.Search(len(messages), func(i int) bool { return less(pivot, &messages[i]) })
+
+	end := start + limit
+	if end > len(messages) {
+		end = len(messages)
+	}
+	if start == end {
+		return nil, end < len(messages), nil
+	}
+	return messages[start:end], end < len(messages), nil
+}
+
+func (s *MemoryStore) MessagesByID(ctx context.Context, ids []uint) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, id := range ids {
+		if m, ok := s.messages[id]; ok && !m.DeletedAt.Valid {
+			messages = append(messages, m)
+		}
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) MessagesAfterID(ctx context.Context, chatID, afterID uint, limit int) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var messages []models.Message
+	for _, m := range s.messages {
+		if m.ChatID == chatID && m.ID > afterID && !m.DeletedAt.Valid {
+			messages = append(messages, m)
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	if len(messages) > limit {
+		messages = messages[:limit]
+	}
+	return messages, nil
+}
+
+func (s *MemoryStore) LastMessageID(ctx context.Context, chatID uint) (uint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var lastID uint
+	for _, m := range s.messages {
+		if m.ChatID == chatID && m.ID > lastID {
+			lastID = m.ID
+		}
+	}
+	return lastID, nil
+}
+
+func (s *MemoryStore) LastMessages(ctx context.Context, chatIDs []uint) ([]models.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	last := make(map[uint]models.Message, len(chatIDs))
+	for _, id := range chatIDs {
+		last[id] = models.Message{}
+	}
+	for _, m := range s.messages {
+		if current, ok := last[m.ChatID]; ok && !m.DeletedAt.Valid && m.ID > current.ID {
+			last[m.ChatID] = m
+		}
+	}
+
+	var messages []models.Message
+	for _, m := range last {
+		if m.ID != 0 {
+			messages = append(messages, m)
+		}
+	}
+	return messages, nil
+}
+
+// SearchMessages ищет слова запроса по префиксу без стемминга, как fts4 в тестах.
+// ранг - число совпавших слов, сниппет - весь текст с отмеченными совпадениями
+func (s *MemoryStore) SearchMessages(ctx context.Context, query SearchQuery) ([]SearchHit, error) {
+	terms := words(strings.ToLower(query.Text))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	s.mu.RLock()
+	var hits []SearchHit
+	for _, m := range s.messages {
+		if m.DeletedAt.Valid || (query.ChatID != 0 && m.ChatID != query.ChatID) {
+			continue
+		}
+		if _, ok := s.members[memberKey{m.ChatID, query.UserID}]; !ok {
+			continue
+		}
+		if query.AuthorID != 0 && (m.AuthorID == nil || *m.AuthorID != query.AuthorID) {
+			continue
+		}
+		if (query.From != nil && m.CreatedAt.Before(*query.From)) || (query.To != nil && !m.CreatedAt.Before(*query.To)) {
+			continue
+		}
+		snippet, rank, ok := highlight(m.Text, terms)
+		if !ok {
+			continue
+		}
+		hits = append(hits, SearchHit{Message: m, ChatTitle: s.chats[m.ChatID].Title, Rank: float64(rank), Snippet: snippet})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return less(&hits[j].Message, &hits[i].Message)
+	})
+	if query.Offset >= len(hits) {
+		return nil, nil
+	}
+	hits = hits[query.Offset:]
+	if len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	return hits, nil
+}
+
+// isWordRune буквы и цифры, остальное разделяет слова
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) })
+}
+
+// highlight отмечает в тексте слова, начинающиеся с одного из terms. подходит только текст,
+// где нашлось каждое слово запроса, второе значение - сколько слов отмечено
+func highlight(text string, terms []string) (string, int, bool) {
+	var b strings.Builder
+	found := make(map[string]bool, len(terms))
+	count := 0
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			b.WriteRune(runes[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && isWordRune(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		matched := false
+		for _, term := range terms {
+			if strings.HasPrefix(strings.ToLower(word), term) {
+				found[term] = true
+				matched = true
+			}
+		}
+		if matched {
+			count++
+			b.WriteString(MarkStart + word + MarkEnd)
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	for _, term := range terms {
+		if !found[term] {
+			return "", 0, false
+		}
+	}
+	return b.String(), count, true
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"sort"
+
+	"chat-api/internal/models"
+)
+
+func (s *MemoryStore) Attachment(ctx context.Context, id uint) (*models.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	attachment, ok := s.attachments[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &attachment, nil
+}
+
+// CreateAttachment в очередь обработки ничего не ставит, превью в памяти не строятся
+func (s *MemoryStore) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachment.ID = s.newID()
+	s.attachments[attachment.ID] = *attachment
+	return nil
+}
+
+func (s *MemoryStore) BeginUpload(ctx context.Context, id uint, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.attachments[id]
+	if !ok || stored.UploadedAt != nil {
+		return ErrConflict
+	}
+	stored.StorageKey = key
+	s.attachments[id] = stored
+	return nil
+}
+
+func (s *MemoryStore) CompleteUpload(ctx context.Context, attachment *models.Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.attachments[attachment.ID]
+	if !ok || stored.UploadedAt != nil {
+		return ErrConflict
+	}
+	stored.SHA256, stored.StorageKey, stored.UploadedAt = attachment.SHA256, attachment.StorageKey, attachment.UploadedAt
+	stored.ExpiresAt = nil
+	s.attachments[stored.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteAttachment(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteAttachment(id)
+	return nil
+}
+
+// deleteAttachment убирает вложение и возвращает ключи его файлов. зовется под блокировкой
+func (s *MemoryStore) deleteAttachment(id uint) []string {
+	attachment, ok := s.attachments[id]
+	if !ok {
+		return nil
+	}
+	delete(s.attachments, id)
+	keys := []string{attachment.StorageKey}
+	for _, t := range attachment.Thumbnails {
+		keys = append(keys, t.StorageKey)
+	}
+	return keys
+}
+
+func (s *MemoryStore) MessageAttachments(ctx context.Context, messageIDs []uint) ([]models.Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	wanted := make(map[uint]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	var attachments []models.Attachment
+	for _, a := range s.attachments {
+		if a.MessageID != nil && wanted[*a.MessageID] {
+			attachments = append(attachments, a)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].ID < attachments[j].ID })
+	return attachments, nil
+}
+
+func (s *MemoryStore) Thumbnail(ctx context.Context, attachmentID uint, size int) (*models.AttachmentThumbnail, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if attachment, ok := s.attachments[attachmentID]; ok {
+		for _, t := range attachment.Thumbnails {
+			if t.Size == size {
+				return &t, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
@@ -0,0 +1,376 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"chat-api/internal/models"
+)
+
+func (s *MemoryStore) CreateMessage(ctx context.Context, message *models.Message, attachmentIDs []uint, mentions []models.MessageMention, mentionAll bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// вложения проверяются до записи, чтобы при отказе ничего не сохранить
+	unique := make(map[uint]bool, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		a, ok := s.attachments[id]
+		if !ok || a.ChatID != message.ChatID || a.MessageID != nil || a.UploadedAt == nil ||
+			a.UploaderID == nil || message.AuthorID == nil || *a.UploaderID != *message.AuthorID {
+			return ErrAttachmentUnavailable
+		}
+		unique[id] = true
+	}
+
+	message.ID = s.newID()
+	s.messages[message.ID] = stored(*message)
+
+	message.Attachments = nil
+	for id := range unique {
+		a := s.attachments[id]
+		messageID := message.ID
+		a.MessageID = &messageID
+		s.attachments[id] = a
+		message.Attachments = append(message.Attachments, a)
+	}
+	sort.Slice(message.Attachments, func(i, j int) bool { return message.Attachments[i].ID < message.Attachments[j].ID })
+
+	for i := range mentions {
+		mentions[i].MessageID = message.ID
+		s.mentions[mentionKey{message.ID, mentions[i].UserID}] = mentions[i]
+	}
+	if mentionAll {
+		for key := range s.members {
+			if key.chatID != message.ChatID || (message.AuthorID != nil && key.userID == *message.AuthorID) {
+				continue
+			}
+			if _, ok := s.mentions[mentionKey{message.ID, key.userID}]; ok {
+				continue
+			}
+			s.mentions[mentionKey{message.ID, key.userID}] = models.MessageMention{
+				MessageID: message.ID,
+				UserID:    key.userID,
+				ChatID:    message.ChatID,
+				Everyone:  true,
+				CreatedAt: message.CreatedAt,
+			}
+		}
+	}
+
+	if message.ParentID != nil {
+		if parent, ok := s.messages[*message.ParentID]; ok && !parent.DeletedAt.Valid {
+			replyAt := message.CreatedAt
+			parent.ReplyCount++
+			parent.LastReplyAt = &replyAt
+			s.messages[parent.ID] = parent
+		}
+	}
+	if chat, ok := s.chats[message.ChatID]; ok {
+		chat.LastActivityAt = message.CreatedAt
+		s.chats[chat.ID] = chat
+	}
+	return nil
+}
+
+func (s *MemoryStore) EditMessage(ctx context.Context, message *models.Message, text string, editedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versionAt := message.CreatedAt
+	if message.EditedAt != nil {
+		versionAt = *message.EditedAt
+	}
+	s.revisions[message.ID] = append(s.revisions[message.ID], models.MessageRevision{
+		ID:        s.newID(),
+		MessageID: message.ID,
+		Text:      message.Text,
+		CreatedAt: versionAt,
+	})
+
+	message.Text = text
+	message.EditedAt = &editedAt
+	if m, ok := s.messages[message.ID]; ok {
+		m.Text, m.EditedAt = text, &editedAt
+		s.messages[m.ID] = m
+	}
+	return nil
+}
+
+func (s *MemoryStore) Revisions(ctx context.Context, messageID uint) ([]models.MessageRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := append([]models.MessageRevision(nil), s.revisions[messageID]...)
+	sort.Slice(revisions, func(i, j int) bool {
+		if !revisions[i].CreatedAt.Equal(revisions[j].CreatedAt) {
+			return revisions[i].CreatedAt.Before(revisions[j].CreatedAt)
+		}
+		return revisions[i].ID < revisions[j].ID
+	})
+	return revisions, nil
+}
+
+func (s *MemoryStore) DeleteMessage(ctx context.Context, message *models.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.pins, message.ID)
+	if m, ok := s.messages[message.ID]; ok {
+		m.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+		s.messages[m.ID] = m
+	}
+	return nil
+}
+
+func (s *MemoryStore) PurgeMessage(ctx context.Context, message *models.Message) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	if message.ParentID == nil {
+		for _, m := range s.messages {
+			if m.ParentID != nil && *m.ParentID == message.ID {
+				keys = append(keys, s.deleteMessage(m.ID)...)
+			}
+		}
+	} else if parent, ok := s.messages[*message.ParentID]; ok && parent.ReplyCount > 0 {
+		parent.ReplyCount--
+		s.messages[parent.ID] = parent
+	}
+	return append(keys, s.deleteMessage(message.ID)...), nil
+}
+
+// deleteMessage стирает сообщение со всем привязанным, как каскад в базе,
+// и возвращает ключи файлов его вложений. зовется под блокировкой
+func (s *MemoryStore) deleteMessage(id uint) []string {
+	var keys []string
+	for _, a := range s.attachments {
+		if a.MessageID != nil && *a.MessageID == id {
+			keys = append(keys, s.deleteAttachment(a.ID)...)
+		}
+	}
+	for key := range s.reactions {
+		if key.messageID == id {
+			delete(s.reactions, key)
+		}
+	}
+	for key := range s.mentions {
+		if key.messageID == id {
+			delete(s.mentions, key)
+		}
+	}
+	delete(s.revisions, id)
+	delete(s.pins, id)
+	delete(s.messages, id)
+	return keys
+}
+
+func (s *MemoryStore) AddReaction(ctx context.Context, reaction *models.MessageReaction) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{reaction.MessageID, reaction.UserID, reaction.Emoji}
+	if _, ok := s.reactions[key]; ok {
+		return false, nil
+	}
+	s.reactions[key] = *reaction
+	return true, nil
+}
+
+func (s *MemoryStore) RemoveReaction(ctx context.Context, messageID, userID uint, emoji string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := reactionKey{messageID, userID, emoji}
+	if _, ok := s.reactions[key]; !ok {
+		return false, nil
+	}
+	delete(s.reactions, key)
+	return true, nil
+}
+
+func (s *MemoryStore) Reactions(ctx context.Context, messageIDs []uint, userID uint) (map[uint][]models.ReactionCount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type group struct {
+		models.ReactionCount
+		first time.Time
+	}
+	wanted := make(map[uint]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	groups := make(map[uint]map[string]*group)
+	for key, reaction := range s.reactions {
+		if !wanted[key.messageID] {
+			continue
+		}
+		if groups[key.messageID] == nil {
+			groups[key.messageID] = make(map[string]*group)
+		}
+		g := groups[key.messageID][key.emoji]
+		if g == nil {
+			g = &group{ReactionCount: models.ReactionCount{Emoji: key.emoji}, first: reaction.CreatedAt}
+			groups[key.messageID][key.emoji] = g
+		}
+		g.Count++
+		g.Me = g.Me || key.userID == userID
+		if reaction.CreatedAt.Before(g.first) {
+			g.first = reaction.CreatedAt
+		}
+	}
+
+	byMessage := make(map[uint][]models.ReactionCount, len(groups))
+	for messageID, emojis := range groups {
+		list := make([]*group, 0, len(emojis))
+		for _, g := range emojis {
+			list = append(list, g)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if !list[i].first.Equal(list[j].first) {
+				return list[i].first.Before(list[j].first)
+			}
+			return list[i].Emoji < list[j].Emoji
+		})
+		for _, g := range list {
+			byMessage[messageID] = append(byMessage[messageID], g.ReactionCount)
+		}
+	}
+	return byMessage, nil
+}
+
+func (s *MemoryStore) PinMessage(ctx context.Context, pin *models.MessagePin, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.pins[pin.MessageID]; ok {
+		*pin = existing
+		return false, nil
+	}
+	count := 0
+	for _, p := range s.pins {
+		if p.ChatID == pin.ChatID {
+			count++
+		}
+	}
+	if count >= limit {
+		return false, ErrLimit
+	}
+
+	saved := *pin
+	saved.Chat, saved.Message, saved.User = nil, nil, nil
+	s.pins[saved.MessageID] = saved
+	*pin = saved
+	return true, nil
+}
+
+func (s *MemoryStore) UnpinMessage(ctx context.Context, chatID, messageID uint) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.pins[messageID]; !ok || p.ChatID != chatID {
+		return false, nil
+	}
+	delete(s.pins, messageID)
+	return true, nil
+}
+
+func (s *MemoryStore) Pins(ctx context.Context, chatID uint) ([]models.MessagePin, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pins []models.MessagePin
+	for _, p := range s.pins {
+		if p.ChatID != chatID {
+			continue
+		}
+		if m, ok := s.messages[p.MessageID]; ok && !m.DeletedAt.Valid {
+			p.Message = &m
+		}
+		pins = append(pins, p)
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if !pins[i].CreatedAt.Equal(pins[j].CreatedAt) {
+			return pins[i].CreatedAt.After(pins[j].CreatedAt)
+		}
+		return pins[i].MessageID > pins[j].MessageID
+	})
+	return pins, nil
+}
+
+func (s *MemoryStore) PinnedIDs(ctx context.Context, chatID uint) ([]uint, error) {
+	pins, err := s.Pins(ctx, chatID)
+	ids := make([]uint, len(pins))
+	for i, p := range pins {
+		ids[i] = p.MessageID
+	}
+	return ids, err
+}
+
+// visibleMention упоминание в живом сообщении чата, где пользователь все еще участник
+func (s *MemoryStore) visibleMention(mention models.MessageMention) bool {
+	m, ok := s.messages[mention.MessageID]
+	if !ok || m.DeletedAt.Valid {
+		return false
+	}
+	_, ok = s.members[memberKey{mention.ChatID, mention.UserID}]
+	return ok
+}
+
+func (s *MemoryStore) Mentions(ctx context.Context, query MentionQuery) ([]MentionHit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hits []MentionHit
+	for key, mention := range s.mentions {
+		if key.userID != query.UserID || !s.visibleMention(mention) {
+			continue
+		}
+		if (query.ChatID != 0 && mention.ChatID != query.ChatID) || (query.Unread && mention.ReadAt != nil) ||
+			(query.Before != 0 && key.messageID >= query.Before) {
+			continue
+		}
+		hits = append(hits, MentionHit{MessageMention: mention, ChatTitle: s.chats[mention.ChatID].Title})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].MessageID > hits[j].MessageID })
+	if len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	return hits, nil
+}
+
+func (s *MemoryStore) UnreadMentions(ctx context.Context, userID uint) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var unread int64
+	for key, mention := range s.mentions {
+		if key.userID == userID && mention.ReadAt == nil && s.visibleMention(mention) {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+func (s *MemoryStore) MarkMentionsRead(ctx context.Context, userID uint, messageIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[uint]bool, len(messageIDs))
+	for _, id := range messageIDs {
+		wanted[id] = true
+	}
+	now := time.Now()
+	for key, mention := range s.mentions {
+		if key.userID != userID || mention.ReadAt != nil || (len(wanted) > 0 && !wanted[key.messageID]) {
+			continue
+		}
+		mention.ReadAt = &now
+		s.mentions[key] = mention
+	}
+	return nil
+}
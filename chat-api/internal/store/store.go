@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"chat-api/internal/models"
+)
+
+// ошибки, которые обработчики разбирают сами, остальные ошибки - сбой хранилища
+var (
+	// ErrNotFound записи нет
+	ErrNotFound = errors.New("not found")
+	// ErrConflict запись уже есть: имя занято, пользователь уже участник, файл уже загружен
+	ErrConflict = errors.New("already exists")
+	// ErrLimit в чате уже максимум закреплений
+	ErrLimit = errors.New("limit reached")
+	// ErrAttachmentUnavailable вложение не найдено, загружено не автором, другой чат или уже в сообщении
+	ErrAttachmentUnavailable = errors.New("attachment unavailable")
+)
+
+// Timeline лента сообщений: корневые сообщения чата или ответы одной ветки.
+// удаленные сообщения остаются в ленте заглушками, порядок по (created_at, id)
+type Timeline struct {
+	ChatID uint
+	RootID uint // 0 - лента чата, иначе ответы на это сообщение
+}
+
+// метки совпадений в сниппете поиска. это управляющие символы, а не html,
+// разметку из них делает тот, кто отдает сниппет клиенту, после экранирования текста
+const (
+	MarkStart = "\x02"
+	MarkEnd   = "\x03"
+)
+
+// SearchQuery полнотекстовый поиск по живым сообщениям из чатов пользователя
+type SearchQuery struct {
+	UserID   uint
+	Text     string
+	ChatID   uint // 0 - во всех чатах
+	AuthorID uint // 0 - любой автор
+	From     *time.Time
+	To       *time.Time
+	Offset   int
+	Limit    int
+}
+
+// SearchHit найденное сообщение, в Snippet совпадения обрамлены MarkStart и MarkEnd
+type SearchHit struct {
+	Message   models.Message
+	ChatTitle string
+	Rank      float64
+	Snippet   string
+}
+
+// ChatCursor позиция в списке чатов, отсортированном по (last_activity_at, id) от новых к старым
+type ChatCursor struct {
+	LastActivityAt time.Time
+	ID             uint
+}
+
+// ChatListQuery страница чатов, где пользователь участник
+type ChatListQuery struct {
+	UserID uint
+	Prefix string      // начало названия без учета регистра, пусто - любое
+	Cursor *ChatCursor // nil - с самых новых
+	Limit  int
+}
+
+// Unread непрочитанное участника: живые корневые сообщения новее позиции чтения, кроме своих
+type Unread struct {
+	Count   int64 `gorm:"column:unread_count"`
+	FirstID *uint `gorm:"column:first_unread_id"`
+}
+
+// ChatSummary строка списка чатов, ответы в ветках не входят ни в один счетчик
+type ChatSummary struct {
+	models.Chat
+	MessageCount      int64
+	LastReadMessageID *uint
+	Unread
+}
+
+// MentionQuery входящие упоминания пользователя от новых к старым
+type MentionQuery struct {
+	UserID uint
+	ChatID uint // 0 - во всех чатах
+	Unread bool // только непрочитанные
+	Before uint // 0 - с самых новых, иначе упоминания в сообщениях с меньшим ид
+	Limit  int
+}
+
+// MentionHit упоминание вместе с названием чата
+type MentionHit struct {
+	models.MessageMention
+	ChatTitle string
+}
+
+// UserStore пользователи
+type UserStore interface {
+	User(ctx context.Context, id uint) (*models.User, error)
+	// UserByName пользователь с точно таким именем
+	UserByName(ctx context.Context, username string) (*models.User, error)
+	// UsersByNames пользователи из списка имен, незнакомые имена пропускаются
+	UsersByNames(ctx context.Context, usernames []string) ([]models.User, error)
+	// CreateUser заводит пользователя и заполняет ид, занятое имя - ErrConflict
+	CreateUser(ctx context.Context, user *models.User) error
+}
+
+// ChatStore чаты, их участники и позиции чтения
+type ChatStore interface {
+	// Chat чат по ид
+	Chat(ctx context.Context, id uint) (*models.Chat, error)
+	// DirectChat личный чат пары, user1ID меньше user2ID
+	DirectChat(ctx context.Context, user1ID, user2ID uint) (*models.Chat, error)
+	// ListChats до limit чатов пользователя со счетчиками, без последних сообщений
+	ListChats(ctx context.Context, query ChatListQuery) ([]ChatSummary, error)
+	// CreateChat создает чат вместе с первыми участниками одной операцией,
+	// заполняет ид чата и счетчик участников
+	CreateChat(ctx context.Context, chat *models.Chat, members []models.ChatMember) error
+	// DeleteChat удаляет чат со всем содержимым и возвращает ключи файлов его вложений
+	// и превью: строки удаляются сразу, а файлы в хранилище убирает вызывающий
+	DeleteChat(ctx context.Context, id uint) ([]string, error)
+	// Member участник чата
+	Member(ctx context.Context, chatID, userID uint) (*models.ChatMember, error)
+	// Members участники чата с пользователями, по времени вступления
+	Members(ctx context.Context, chatID uint) ([]models.ChatMember, error)
+	// MemberIDs кто из перечисленных пользователей участник чата
+	MemberIDs(ctx context.Context, chatID uint, userIDs []uint) ([]uint, error)
+	// AddMember добавляет участника и двигает счетчик чата, уже участник - ErrConflict
+	AddMember(ctx context.Context, member *models.ChatMember) error
+	// RemoveMember убирает участника и двигает счетчик, false если его и не было
+	RemoveMember(ctx context.Context, chatID, userID uint) (bool, error)
+	// Unread непрочитанное участника в чате
+	Unread(ctx context.Context, chatID, userID uint) (Unread, error)
+	// MarkRead отмечает прочитанными упоминания в ленте до messageID и двигает позицию чтения
+	// к нему, но только вперед: false если позиция уже там или дальше
+	MarkRead(ctx context.Context, chatID, userID, messageID uint) (bool, error)
+}
+
+// MessageStore сообщения и все, что к ним привязано: ревизии, реакции, закрепления, упоминания
+type MessageStore interface {
+	// Message сообщение внутри чата, withDeleted включает удаленные
+	Message(ctx context.Context, chatID, id uint, withDeleted bool) (*models.Message, error)
+	// Before до limit сообщений ленты старше pivot (или самых новых если pivot nil)
+	// по возрастанию и признак что есть еще более старые
+	Before(ctx context.Context, timeline Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error)
+	// After до limit сообщений ленты новее pivot по возрастанию и признак что есть еще более новые
+	After(ctx context.Context, timeline Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error)
+	// MessagesByID живые сообщения из списка ид в любых чатах
+	MessagesByID(ctx context.Context, ids []uint) ([]models.Message, error)
+	// MessagesAfterID до limit живых сообщений чата, в том числе ответов, с ид больше afterID по возрастанию ид
+	MessagesAfterID(ctx context.Context, chatID, afterID uint, limit int) ([]models.Message, error)
+	// LastMessageID ид последнего сообщения чата, в том числе удаленного и ответа, 0 если сообщений нет
+	LastMessageID(ctx context.Context, chatID uint) (uint, error)
+	// LastMessages последнее живое сообщение каждого из чатов, ответы тоже считаются
+	LastMessages(ctx context.Context, chatIDs []uint) ([]models.Message, error)
+	// SearchMessages лучшие совпадения первыми, при равном ранге новые раньше
+	SearchMessages(ctx context.Context, query SearchQuery) ([]SearchHit, error)
+
+	// CreateMessage одной операцией сохраняет сообщение, привязывает к нему вложения
+	// и записывает упоминания, у ответа двигает счетчик корня, у чата время активности.
+	// mentionAll упоминает еще и всех остальных участников кроме автора.
+	// заполняет ид сообщения и его вложения
+	CreateMessage(ctx context.Context, message *models.Message, attachmentIDs []uint, mentions []models.MessageMention, mentionAll bool) error
+	// EditMessage меняет текст, прежний уходит в ревизии
+	EditMessage(ctx context.Context, message *models.Message, text string, editedAt time.Time) error
+	// Revisions прежние версии текста, старые первыми
+	Revisions(ctx context.Context, messageID uint) ([]models.MessageRevision, error)
+	// DeleteMessage мягко удаляет сообщение и снимает его закрепление
+	DeleteMessage(ctx context.Context, message *models.Message) error
+	// PurgeMessage стирает сообщение совсем: корень вместе с веткой, у ответа уменьшает счетчик корня.
+	// возвращает ключи файлов вложений, как DeleteChat
+	PurgeMessage(ctx context.Context, message *models.Message) ([]string, error)
+
+	// AddReaction ставит реакцию, false если она уже стояла
+	AddReaction(ctx context.Context, reaction *models.MessageReaction) (bool, error)
+	// RemoveReaction снимает реакцию, false если ее не было
+	RemoveReaction(ctx context.Context, messageID, userID uint, emoji string) (bool, error)
+	// Reactions сводка реакций по сообщениям в порядке первой постановки, me - реакции userID
+	Reactions(ctx context.Context, messageIDs []uint, userID uint) (map[uint][]models.ReactionCount, error)
+
+	// PinMessage закрепляет сообщение и заполняет pin сохраненной записью.
+	// false если уже закреплено, ErrLimit если в чате уже limit закреплений
+	PinMessage(ctx context.Context, pin *models.MessagePin, limit int) (bool, error)
+	// UnpinMessage снимает закрепление, false если его не было
+	UnpinMessage(ctx context.Context, chatID, messageID uint) (bool, error)
+	// Pins закрепления чата с сообщениями, последние закрепленные первыми
+	Pins(ctx context.Context, chatID uint) ([]models.MessagePin, error)
+	// PinnedIDs ид закрепленных сообщений чата в том же порядке
+	PinnedIDs(ctx context.Context, chatID uint) ([]uint, error)
+
+	// Mentions упоминания в живых сообщениях чатов, где пользователь все еще участник
+	Mentions(ctx context.Context, query MentionQuery) ([]MentionHit, error)
+	// UnreadMentions сколько таких упоминаний еще не прочитано
+	UnreadMentions(ctx context.Context, userID uint) (int64, error)
+	// MarkMentionsRead отмечает прочитанными упоминания в перечисленных сообщениях, без них все
+	MarkMentionsRead(ctx context.Context, userID uint, messageIDs []uint) error
+}
+
+// AttachmentStore метаданные вложений, содержимое лежит в storage.BlobStore
+type AttachmentStore interface {
+	// Attachment вложение по ид, в том числе еще не загруженное
+	Attachment(ctx context.Context, id uint) (*models.Attachment, error)
+	// CreateAttachment сохраняет вложение и заполняет ид. уже загруженный файл
+	// сразу ставится в очередь фоновой обработки
+	CreateAttachment(ctx context.Context, attachment *models.Attachment) error
+	// BeginUpload запоминает ключ, под который пишется файл, чтобы просроченную
+	// резервацию можно было удалить вместе с недописанным файлом. уже загруженное - ErrConflict
+	BeginUpload(ctx context.Context, id uint, key string) error
+	// CompleteUpload записывает ключ, хеш и время загрузки, снимает срок резервации
+	// и ставит файл в очередь обработки. загрузить можно один раз, повторная загрузка - ErrConflict
+	CompleteUpload(ctx context.Context, attachment *models.Attachment) error
+	// DeleteAttachment удаляет строку вложения, файл убирает вызывающий
+	DeleteAttachment(ctx context.Context, id uint) error
+	// MessageAttachments вложения сообщений с превью, по возрастанию ид
+	MessageAttachments(ctx context.Context, messageIDs []uint) ([]models.Attachment, error)
+	// Thumbnail превью вложения нужного размера
+	Thumbnail(ctx context.Context, attachmentID uint, size int) (*models.AttachmentThumbnail, error)
+}
+
+// Store все хранилища вместе, его реализуют GormStore и MemoryStore
+type Store interface {
+	UserStore
+	ChatStore
+	MessageStore
+	AttachmentStore
+}
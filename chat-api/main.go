@@ -1,47 +1,181 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/jackc/pgx/v5/stdlib" //докер ругается если не объявлять
 
+	"chat-api/internal/auth"
 	"chat-api/internal/config"
 	"chat-api/internal/database"
+	"chat-api/internal/emoji"
 	"chat-api/internal/handlers"
+	"chat-api/internal/jobs"
+	"chat-api/internal/metrics"
 	"chat-api/internal/middleware"
+	"chat-api/internal/presence"
+	"chat-api/internal/realtime"
+	"chat-api/internal/storage"
+	"chat-api/internal/store"
 )
 
 func main() {
 	// подставляем конфиг данные по бд
 	cfg := config.Load()
 
+	// логи в json, стандартный log тоже уходит сюда
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	slog.SetDefault(logger)
+
+	// chat-api migrate ... управляет миграциями и выходит, сервер не запускается
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(cfg, os.Args[2:])
+		return
+	}
+
+	// SIGINT и SIGTERM останавливают сервер и воркер
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	//инициация бд
 	db, err := database.InitDB(cfg)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// метрики собираются всегда, отдаются только если задан админский порт
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatal("Failed to get database pool:", err)
+	}
+	appMetrics := metrics.New(sqlDB)
+
 	// от горилы маршрутизатор по url
 	r := mux.NewRouter()
 
-	// Мидлвары
-	r.Use(middleware.Logging)
+	// Мидлвары. RequestID, логи и метрики стоят на всем сервере, иначе без них остаются ответы 404 и 405
+	// мимо маршрутов, Route передает им шаблон найденного маршрута
+	r.Use(middleware.Route)
 	r.Use(middleware.JSONContentType)
 
+	// ключи подписи токенов из конфига
+	issuer, err := auth.NewIssuer(cfg)
+	if err != nil {
+		log.Fatal("Invalid JWT configuration:", err)
+	}
+
+	// кто печатает и кто онлайн, при нескольких серверах нужен общий redis
+	presenceStore, err := presence.New(cfg.RedisURL)
+	if err != nil {
+		log.Fatal("Invalid presence configuration:", err)
+	}
+
+	// вложения на диске или в S3 совместимом хранилище
+	blobs, err := storage.New(cfg)
+	if err != nil {
+		log.Fatal("Invalid blob storage configuration:", err)
+	}
+
+	// превью и метаданные картинок строятся в фоне по очереди в базе
+	worker := &jobs.Worker{
+		DB:          db,
+		Blobs:       blobs,
+		Sizes:       cfg.ThumbnailSizes,
+		Interval:    cfg.JobInterval,
+		MaxAttempts: cfg.JobAttempts,
+		Backoff:     cfg.JobBackoff,
+		Logger:      logger,
+	}
+	workerDone := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(workerDone)
+	}()
+
 	//с пакета обработчиков инициализируется
-	handlers.InitHandlers(r, db)
+	chatStore := store.NewGormStore(db)
+	handlers.InitHandlers(r, &handlers.Handler{
+		Users:       chatStore,
+		Chats:       chatStore,
+		Messages:    chatStore,
+		Attachments: chatStore,
+		Auth:        issuer,
+		Hub:         realtime.NewHub(), // рассылка новых сообщений по вебсокетам
+		Emoji:       emoji.NewRegistry(cfg.CustomEmojis),
+		Presence:    presenceStore,
+		TypingTTL:   cfg.TypingTTL,
+		OnlineTTL:   cfg.OnlineTTL,
+		Blobs:       blobs,
+		UploadLimit: cfg.UploadLimit,
+		PinLimit:    cfg.PinLimit,
+		Metrics:     appMetrics,
+		Logger:      logger,
+	})
+
+	// /metrics на отдельном порту, наружу его не публикуют
+	var adminSrv *http.Server
+	if cfg.AdminPort != "" {
+		admin := http.NewServeMux()
+		admin.Handle("GET /metrics", appMetrics.Handler())
+		adminSrv = &http.Server{
+			Handler:      admin,
+			Addr:         ":" + cfg.AdminPort,
+			WriteTimeout: cfg.WriteTimeout,
+			ReadTimeout:  cfg.ReadTimeout,
+		}
+		go func() {
+			logger.Info("Admin server starting", "port", cfg.AdminPort)
+			if err := adminSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal(err)
+			}
+		}()
+	}
 
 	// сервер запускается на порту из конфига
 	srv := &http.Server{
-		Handler:      r, // в качестве хендлера горилавские обработчики
+		Handler:      middleware.RequestID(middleware.Logging(logger)(middleware.Metrics(appMetrics)(r))), // в качестве хендлера горилавские обработчики
 		Addr:         ":" + cfg.ServerPort,
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		WriteTimeout: cfg.WriteTimeout, // SSE и вебсокеты снимают его для себя
+		ReadTimeout:  cfg.ReadTimeout,
 	}
 
-	log.Printf("Server starting on port %s", cfg.ServerPort)
-	log.Fatal(srv.ListenAndServe()) //при ошибке создать серв
+	go func() {
+		logger.Info("Server starting", "port", cfg.ServerPort)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err) //при ошибке создать серв
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("Server stopping")
+	shutdown(srv, adminSrv, cfg.ShutdownTimeout, logger)
+	// воркер дописывает итог текущей задачи
+	<-workerDone
+	logger.Info("Server stopped")
+}
+
+// shutdown дает запросам завершиться за timeout. SSE потоки и сокеты сами не заканчиваются,
+// их по истечении рвем через Close
+func shutdown(srv, adminSrv *http.Server, timeout time.Duration, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, s := range []*http.Server{srv, adminSrv} {
+		if s == nil {
+			continue
+		}
+		if err := s.Shutdown(ctx); err != nil {
+			logger.Warn("Graceful shutdown timed out, closing connections", "addr", s.Addr, "error", err)
+			s.Close()
+		}
+	}
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+
+	"chat-api/internal/config"
+	"chat-api/internal/database"
+)
+
+const migrateUsage = "usage: chat-api migrate up|down|status|redo|create NAME"
+
+// runMigrate подкоманда migrate: миграции без запуска сервера.
+// create пишет файл в ./migrations, поэтому запускается из корня проекта
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+		}
+		path, err := database.CreateMigration("migrations", args[1])
+		if err != nil {
+			log.Fatal("Failed to create migration:", err)
+		}
+		slog.Info("Создана миграция", "path", path)
+		return
+	case "up", "down", "status", "redo":
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db, args[0]); err != nil {
+		log.Fatal("Migration failed:", err)
+	}
+}
@@ -0,0 +1,21 @@
+-- +goose Up
+-- таблица пользователей
+CREATE TABLE users (
+    id SERIAL PRIMARY KEY,
+    username VARCHAR(50) NOT NULL,
+    password_hash VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_users_username ON users(username);
+
+-- автор сообщения, у старых сообщений остается NULL
+ALTER TABLE messages ADD COLUMN author_id INTEGER;
+ALTER TABLE messages ADD CONSTRAINT fk_author FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_messages_author_id ON messages(author_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_author_id;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_author;
+ALTER TABLE messages DROP COLUMN IF EXISTS author_id;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- участники чатов с ролями
+CREATE TABLE chat_members (
+    chat_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (chat_id, user_id),
+    CONSTRAINT fk_member_chat FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    CONSTRAINT fk_member_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT chk_member_role CHECK (role IN ('owner', 'admin', 'member'))
+);
+
+CREATE INDEX idx_chat_members_user_id ON chat_members(user_id);
+
+-- у старых чатов владельца нет, авторов сообщений делаем участниками
+INSERT INTO chat_members (chat_id, user_id, role)
+SELECT DISTINCT chat_id, author_id, 'member' FROM messages WHERE author_id IS NOT NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS chat_members;
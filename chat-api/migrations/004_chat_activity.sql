@@ -0,0 +1,17 @@
+-- +goose Up
+-- время последней активности для сортировки списка чатов
+ALTER TABLE chats ADD COLUMN last_activity_at TIMESTAMP;
+
+UPDATE chats SET last_activity_at = COALESCE(
+    (SELECT MAX(created_at) FROM messages WHERE messages.chat_id = chats.id),
+    created_at
+);
+
+ALTER TABLE chats ALTER COLUMN last_activity_at SET NOT NULL;
+ALTER TABLE chats ALTER COLUMN last_activity_at SET DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_chats_last_activity ON chats(last_activity_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_chats_last_activity;
+ALTER TABLE chats DROP COLUMN IF EXISTS last_activity_at;
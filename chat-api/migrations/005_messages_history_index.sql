@@ -0,0 +1,6 @@
+-- +goose Up
+-- индекс под постраничную историю по (created_at, id) внутри чата
+CREATE INDEX idx_messages_chat_created_id ON messages(chat_id, created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_chat_created_id;
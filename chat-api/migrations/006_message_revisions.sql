@@ -0,0 +1,18 @@
+-- +goose Up
+-- время последней правки сообщения
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP;
+
+-- прежние версии текста сообщений
+CREATE TABLE message_revisions (
+    id SERIAL PRIMARY KEY,
+    message_id INTEGER NOT NULL,
+    text VARCHAR(5000) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_revision_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_revisions_message_id ON message_revisions(message_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_revisions;
+ALTER TABLE messages DROP COLUMN IF EXISTS edited_at;
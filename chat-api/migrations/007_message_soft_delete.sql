@@ -0,0 +1,8 @@
+-- +goose Up
+-- мягкое удаление сообщений, в истории остается заглушка
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP;
+CREATE INDEX idx_messages_deleted_at ON messages(deleted_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_deleted_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_at;
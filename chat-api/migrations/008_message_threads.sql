@@ -0,0 +1,18 @@
+-- +goose Up
+-- ответы в ветках, счетчики ведутся на корневом сообщении
+ALTER TABLE messages ADD COLUMN parent_id INTEGER;
+ALTER TABLE messages ADD COLUMN reply_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE messages ADD COLUMN last_reply_at TIMESTAMP;
+ALTER TABLE messages ADD CONSTRAINT fk_parent FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE CASCADE;
+
+-- лента чата без ответов и страницы ветки
+CREATE INDEX idx_messages_chat_roots ON messages(chat_id, created_at, id) WHERE parent_id IS NULL;
+CREATE INDEX idx_messages_thread ON messages(parent_id, created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_thread;
+DROP INDEX IF EXISTS idx_messages_chat_roots;
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_parent;
+ALTER TABLE messages DROP COLUMN IF EXISTS last_reply_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS reply_count;
+ALTER TABLE messages DROP COLUMN IF EXISTS parent_id;
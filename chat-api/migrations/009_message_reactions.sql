@@ -0,0 +1,16 @@
+-- +goose Up
+-- реакции на сообщения, один пользователь ставит каждое эмодзи один раз
+CREATE TABLE message_reactions (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (message_id, user_id, emoji),
+    CONSTRAINT fk_reaction_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_reaction_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_reactions_user_id ON message_reactions(user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_reactions;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- полнотекстовый поиск по сообщениям, словарь russian, латиница стеммится как английский
+ALTER TABLE messages ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('russian', text)) STORED;
+
+CREATE INDEX idx_messages_search ON messages USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_messages_search;
+ALTER TABLE messages DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- позиция чтения участника, сравнивается с ид сообщений, поэтому без внешнего ключа:
+-- стертое сообщение не должно сбрасывать прочитанное
+ALTER TABLE chat_members ADD COLUMN last_read_message_id INTEGER;
+
+-- +goose Down
+ALTER TABLE chat_members DROP COLUMN IF EXISTS last_read_message_id;
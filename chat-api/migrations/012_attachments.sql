@@ -0,0 +1,26 @@
+-- +goose Up
+-- вложения сообщений, содержимое лежит в хранилище по storage_key.
+-- до отправки сообщения message_id пустой, uploaded_at ставится после загрузки файла
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER,
+    uploader_id INTEGER,
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    size BIGINT NOT NULL,
+    sha256 VARCHAR(64),
+    storage_key VARCHAR(255),
+    uploaded_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_attachment_chat FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    CONSTRAINT fk_attachment_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_attachment_uploader FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_attachments_chat_id ON attachments(chat_id);
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+CREATE INDEX idx_attachments_uploader_id ON attachments(uploader_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS attachments;
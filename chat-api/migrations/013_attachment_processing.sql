@@ -0,0 +1,41 @@
+-- +goose Up
+-- метаданные картинок, заполняются фоновой обработкой после загрузки
+ALTER TABLE attachments ADD COLUMN width INTEGER;
+ALTER TABLE attachments ADD COLUMN height INTEGER;
+ALTER TABLE attachments ADD COLUMN blurhash VARCHAR(100);
+
+-- превью картинок, size - ограничение на большую сторону
+CREATE TABLE attachment_thumbnails (
+    attachment_id INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    mime_type VARCHAR(255) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    PRIMARY KEY (attachment_id, size),
+    CONSTRAINT fk_attachment_thumbnail_attachment FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+
+-- очередь обработки вложений: одна задача на вложение, повторы с растущей паузой.
+-- пока задача в работе, run_at сдвинут на время аренды
+CREATE TABLE attachment_jobs (
+    id SERIAL PRIMARY KEY,
+    attachment_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    run_at TIMESTAMP NOT NULL,
+    last_error VARCHAR(1000),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CONSTRAINT fk_attachment_job_attachment FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX idx_attachment_jobs_attachment_id ON attachment_jobs(attachment_id);
+CREATE INDEX idx_attachment_jobs_due ON attachment_jobs(status, run_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS attachment_jobs;
+DROP TABLE IF EXISTS attachment_thumbnails;
+ALTER TABLE attachments DROP COLUMN IF EXISTS blurhash;
+ALTER TABLE attachments DROP COLUMN IF EXISTS height;
+ALTER TABLE attachments DROP COLUMN IF EXISTS width;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- упоминания участников в сообщениях, по ним строятся входящие GET /me/mentions.
+-- everyone - упомянут через @all, read_at пустой пока упоминание не прочитано
+CREATE TABLE message_mentions (
+    message_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    chat_id INTEGER NOT NULL,
+    everyone BOOLEAN NOT NULL DEFAULT FALSE,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    CONSTRAINT fk_message_mention_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_mention_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_mention_chat FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_mentions_inbox ON message_mentions(user_id, message_id);
+CREATE INDEX idx_message_mentions_chat_id ON message_mentions(chat_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_mentions;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- закрепленные сообщения чата, лимит на чат задается PIN_LIMIT
+CREATE TABLE message_pins (
+    chat_id INTEGER NOT NULL,
+    message_id INTEGER NOT NULL,
+    pinned_by INTEGER,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chat_id, message_id),
+    CONSTRAINT fk_message_pin_chat FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_pin_message FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    CONSTRAINT fk_message_pin_user FOREIGN KEY (pinned_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_message_pins_message_id ON message_pins(message_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_pins;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- личные чаты: пара участников хранится упорядоченной (direct_user1_id < direct_user2_id),
+-- уникальный индекс оставляет паре один чат. у групповых чатов пара пустая
+ALTER TABLE chats ADD COLUMN type VARCHAR(20) NOT NULL DEFAULT 'group';
+ALTER TABLE chats ADD COLUMN direct_user1_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE chats ADD COLUMN direct_user2_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE chats ADD CONSTRAINT chk_chats_direct_pair
+    CHECK (type <> 'direct' OR direct_user1_id IS NULL OR direct_user2_id IS NULL OR direct_user1_id < direct_user2_id);
+
+CREATE UNIQUE INDEX idx_chats_direct_pair ON chats(direct_user1_id, direct_user2_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_chats_direct_pair;
+ALTER TABLE chats DROP CONSTRAINT IF EXISTS chk_chats_direct_pair;
+ALTER TABLE chats DROP COLUMN IF EXISTS direct_user2_id;
+ALTER TABLE chats DROP COLUMN IF EXISTS direct_user1_id;
+ALTER TABLE chats DROP COLUMN IF EXISTS type;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- счетчик участников (у канала - подписчиков) хранится в самом чате,
+-- приложение двигает его вместе с составом, здесь только заполняем для существующих чатов
+ALTER TABLE chats ADD COLUMN member_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE chats SET member_count = (SELECT COUNT(*) FROM chat_members WHERE chat_members.chat_id = chats.id);
+
+-- +goose Down
+ALTER TABLE chats DROP COLUMN IF EXISTS member_count;
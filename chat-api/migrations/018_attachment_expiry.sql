@@ -0,0 +1,10 @@
+-- +goose Up
+-- резервация вложения без загрузки живет до expires_at, потом воркер удаляет ее
+-- вместе с недописанным файлом. после загрузки expires_at пустой
+ALTER TABLE attachments ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX idx_attachments_expires_at ON attachments(expires_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_attachments_expires_at;
+ALTER TABLE attachments DROP COLUMN IF EXISTS expires_at;
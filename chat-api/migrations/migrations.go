@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS миграции goose зашиты в бинарник, чтобы не зависеть от рабочей директории.
+// имена вида NNN_name.sql, новые создаются через chat-api migrate create
+//
+//go:embed *.sql
+var FS embed.FS
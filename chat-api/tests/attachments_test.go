@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+type testFile struct {
+	name     string
+	mimeType string
+	content  string
+}
+
+func (suite *HandlersTestSuite) postMultipart(chatID uint, text string, files []testFile, token string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if text != "" {
+		form.WriteField("text", text)
+	}
+	for _, f := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, f.name))
+		header.Set("Content-Type", f.mimeType)
+		part, _ := form.CreatePart(header)
+		io.WriteString(part, f.content)
+	}
+	form.Close()
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/chats/%d/messages", chatID), &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func (suite *HandlersTestSuite) download(attachmentID uint, rangeHeader, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/attachments/%d", attachmentID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// reserveAttachment получает токен и загружает по нему содержимое
+func (suite *HandlersTestSuite) reserveAttachment(chatID uint, name, content, token string) (models.Attachment, string) {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/attachments", chatID), map[string]interface{}{
+		"filename":  name,
+		"mime_type": "text/plain",
+		"size":      len(content),
+	}, token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var response struct {
+		Attachment models.Attachment `json:"attachment"`
+		UploadURL  string            `json:"upload_url"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response.Attachment, response.UploadURL
+}
+
+func (suite *HandlersTestSuite) upload(uploadURL, content string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", uploadURL, strings.NewReader(content))
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func (suite *HandlersTestSuite) TestAttachments_MultipartUpload() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Файлы", suite.user.ID)
+	rr := suite.postMultipart(chat.ID, "Смотрите отчет", []testFile{
+		{"../../отчет.txt", "text/plain; charset=utf-8", "hello attachments"},
+		{"photo.png", "image/png", "\x89PNG fake"},
+	}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	assert.Equal(t, "Смотрите отчет", message.Text)
+	if !assert.Len(t, message.Attachments, 2) {
+		return
+	}
+	report := message.Attachments[0]
+	assert.Equal(t, "отчет.txt", report.Filename)
+	assert.Equal(t, "text/plain; charset=utf-8", report.MimeType)
+	assert.Equal(t, int64(17), report.Size)
+	// sha256("hello attachments")
+	assert.Equal(t, "42d3a7895ec8c25e9cda3e1ea5377a512db52029fadc49d34e70c57a1a54ebaf", report.SHA256)
+
+	page := suite.getHistory(chat.ID, "")
+	if assert.Len(t, page.Messages, 1) {
+		assert.Len(t, page.Messages[0].Attachments, 2)
+	}
+
+	rr = suite.download(report.ID, "", suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "hello attachments", rr.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+
+	rr = suite.download(report.ID, "bytes=6-16", suite.token)
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "attachments", rr.Body.String())
+	assert.Equal(t, "bytes 6-16/17", rr.Header().Get("Content-Range"))
+
+	// файлы видят только участники
+	_, strangerToken := createTestUser(t, "stranger")
+	rr = suite.download(report.ID, "", strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// сообщение из одних файлов без текста
+	rr = suite.postMultipart(chat.ID, "", []testFile{{"a.txt", "text/plain", "a"}}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = suite.postMultipart(chat.ID, "", []testFile{{"big.bin", "", strings.Repeat("x", testUploadLimit+1)}}, suite.token)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestAttachments_UploadToken() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Файлы", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleMember)
+
+	attachment, uploadURL := suite.reserveAttachment(chat.ID, "notes.txt", "token upload", suite.token)
+	assert.True(t, strings.HasPrefix(uploadURL, "/uploads/"))
+
+	// до загрузки прикрепить нельзя
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID),
+		map[string]interface{}{"attachment_ids": []uint{attachment.ID}}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = suite.upload(uploadURL, "wrong size")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = suite.upload(uploadURL, "token upload")
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = suite.upload(uploadURL, "token upload")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	// токен загрузки не годится для API
+	rr = performAuthRequest(suite.router, "GET", "/chats", nil, strings.TrimPrefix(uploadURL, "/uploads/"))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// пока файл не отправлен, его видит только загрузивший
+	assert.Equal(t, http.StatusOK, suite.download(attachment.ID, "", suite.token).Code)
+	assert.Equal(t, http.StatusNotFound, suite.download(attachment.ID, "", friendToken).Code)
+
+	// чужое вложение прикрепить нельзя
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID),
+		map[string]interface{}{"attachment_ids": []uint{attachment.ID}}, friendToken)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID),
+		map[string]interface{}{"attachment_ids": []uint{attachment.ID}}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	if assert.Len(t, message.Attachments, 1) {
+		assert.Equal(t, attachment.ID, message.Attachments[0].ID)
+	}
+
+	// повторно то же вложение не прикрепляется
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID),
+		map[string]interface{}{"text": "еще раз", "attachment_ids": []uint{attachment.ID}}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = suite.download(attachment.ID, "", friendToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "token upload", rr.Body.String())
+
+	rr = suite.upload("/uploads/not-a-token", "x")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestAttachments_DeletedMessage() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Файлы", suite.user.ID)
+	rr := suite.postMultipart(chat.ID, "Секрет", []testFile{{"secret.txt", "text/plain", "secret"}}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	if !assert.Len(t, message.Attachments, 1) {
+		return
+	}
+	attachment := message.Attachments[0]
+
+	stored, err := testStore.Attachment(context.Background(), attachment.ID)
+	if !assert.NoError(t, err) {
+		return
+	}
+	blobPath := filepath.Join(testBlobDir, filepath.FromSlash(stored.StorageKey))
+	_, err = os.Stat(blobPath)
+	assert.NoError(t, err)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, message.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, http.StatusNotFound, suite.download(attachment.ID, "", suite.token).Code)
+
+	// полное удаление стирает и файл
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d?purge=true", chat.ID, message.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	_, err = os.Stat(blobPath)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/auth"
+	"chat-api/internal/config"
+	"chat-api/internal/models"
+)
+
+func (suite *HandlersTestSuite) TestRegister_Success() {
+	t := suite.T()
+
+	requestBody := map[string]string{
+		"username": "alice",
+		"password": "secret-password",
+	}
+
+	rr := performRequest(suite.router, "POST", "/auth/register", requestBody)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var user models.User
+	err := json.Unmarshal(rr.Body.Bytes(), &user)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.NotZero(t, user.ID)
+	assert.NotContains(t, rr.Body.String(), "password")
+}
+
+func (suite *HandlersTestSuite) TestRegister_Invalid() {
+	t := suite.T()
+
+	rr := performRequest(suite.router, "POST", "/auth/register", map[string]string{
+		"username": "a b",
+		"password": "secret-password",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = performRequest(suite.router, "POST", "/auth/register", map[string]string{
+		"username": "alice",
+		"password": "short",
+	})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestRegister_DuplicateUsername() {
+	t := suite.T()
+
+	createTestUser(t, "alice")
+
+	rr := performRequest(suite.router, "POST", "/auth/register", map[string]string{
+		"username": "alice",
+		"password": "secret-password",
+	})
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestRegister_Concurrent() {
+	t := suite.T()
+
+	// проигравшие гонку получают 409, а не 500 от уникального индекса
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = performRequest(suite.router, "POST", "/auth/register", map[string]string{
+				"username": "racer",
+				"password": "secret-password",
+			}).Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		assert.Contains(t, []int{http.StatusCreated, http.StatusConflict}, code)
+		if code == http.StatusCreated {
+			created++
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func (suite *HandlersTestSuite) TestLogin() {
+	t := suite.T()
+
+	credentials := map[string]string{
+		"username": "bob",
+		"password": "secret-password",
+	}
+	rr := performRequest(suite.router, "POST", "/auth/register", credentials)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = performRequest(suite.router, "POST", "/auth/login", credentials)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, response.Token)
+
+	userID, err := testIssuer.Parse(response.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, response.User.ID, userID)
+
+	credentials["password"] = "wrong-password"
+	rr = performRequest(suite.router, "POST", "/auth/login", credentials)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestAuth_ProtectedRoutes() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Закрытый чат", suite.user.ID)
+
+	rr := performRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+
+	rr = performRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = performRequest(suite.router, "POST", "/chats", map[string]string{"title": "Чат"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestAuth_KeyRotation() {
+	t := suite.T()
+
+	seed := base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+	oldIssuer, err := auth.NewIssuer(&config.Config{
+		JWTKeys:  []config.JWTKey{{ID: "old", Algorithm: "EdDSA", Secret: seed}},
+		TokenTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+
+	// новый ключ активный, старый остается для проверки
+	rotated, err := auth.NewIssuer(&config.Config{
+		JWTKeys: []config.JWTKey{
+			{ID: "old", Algorithm: "EdDSA", Secret: seed},
+			{ID: "new", Algorithm: "HS256", Secret: "new-secret-new-secret-new-secret-new"},
+		},
+		JWTActiveKID: "new",
+		TokenTTL:     time.Hour,
+	})
+	assert.NoError(t, err)
+
+	oldToken, err := oldIssuer.Issue(42)
+	assert.NoError(t, err)
+	userID, err := rotated.Parse(oldToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), userID)
+
+	newToken, err := rotated.Issue(7)
+	assert.NoError(t, err)
+	_, err = oldIssuer.Parse(newToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken, "неизвестный kid")
+
+	userID, err = rotated.Parse(newToken)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), userID)
+}
+
+func (suite *HandlersTestSuite) TestAuth_RejectsAlgorithmMismatch() {
+	t := suite.T()
+
+	// HS256 токен с kid от ключа EdDSA не должен проходить
+	seed := base64.StdEncoding.EncodeToString(make([]byte, ed25519.SeedSize))
+	issuer, err := auth.NewIssuer(&config.Config{
+		JWTKeys:  []config.JWTKey{{ID: "ed", Algorithm: "EdDSA", Secret: seed}},
+		TokenTTL: time.Hour,
+	})
+	assert.NoError(t, err)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	token.Header["kid"] = "ed"
+	signed, err := token.SignedString([]byte(seed))
+	assert.NoError(t, err)
+
+	_, err = issuer.Parse(signed)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func (suite *HandlersTestSuite) TestAuth_ExpiredToken() {
+	t := suite.T()
+
+	expired, err := auth.NewIssuer(&config.Config{
+		JWTKeys:  testConfig.JWTKeys,
+		TokenTTL: -time.Minute,
+	})
+	assert.NoError(t, err)
+
+	token, err := expired.Issue(1)
+	assert.NoError(t, err)
+
+	rr := performAuthRequest(suite.router, "POST", "/chats", map[string]string{"title": "Чат"}, token)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestAuth_RequiresSecret() {
+	t := suite.T()
+
+	// без ключей в окружении запасного секрета нет
+	t.Setenv("JWT_KEYS", "")
+	t.Setenv("JWT_SECRET", "")
+	_, err := auth.NewIssuer(config.Load())
+	assert.Error(t, err)
+
+	t.Setenv("JWT_SECRET", "short-secret")
+	_, err = auth.NewIssuer(config.Load())
+	assert.Error(t, err, "HS256 секрет короче 32 байт")
+
+	t.Setenv("JWT_SECRET", "0123456789abcdef0123456789abcdef")
+	_, err = auth.NewIssuer(config.Load())
+	assert.NoError(t, err)
+}
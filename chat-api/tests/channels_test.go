@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+	"chat-api/internal/realtime"
+)
+
+func subscriptionPath(chatID uint) string {
+	return fmt.Sprintf("/chats/%d/subscription", chatID)
+}
+
+func (suite *HandlersTestSuite) createChannel(title string) models.Chat {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", "/chats", map[string]string{"type": "channel", "title": title}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+	return chat
+}
+
+func (suite *HandlersTestSuite) memberCount(chatID uint) int {
+	chat, err := testStore.Chat(context.Background(), chatID)
+	assert.NoError(suite.T(), err)
+	return chat.MemberCount
+}
+
+func (suite *HandlersTestSuite) TestChannels_OnlyPublishersPost() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	channel := suite.createChannel("Новости")
+	assert.Equal(t, models.ChatChannel, channel.Type)
+	assert.Equal(t, 1, channel.MemberCount)
+
+	_, aliceToken := createTestUser(t, "alice")
+	editor, editorToken := createTestUser(t, "editor")
+
+	// подписаться может любой, повторная подписка ничего не меняет
+	rr := performAuthRequest(suite.router, "PUT", subscriptionPath(channel.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var subscribed models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &subscribed)
+	assert.Equal(t, 2, subscribed.MemberCount)
+	rr = performAuthRequest(suite.router, "PUT", subscriptionPath(channel.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 2, suite.memberCount(channel.ID))
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", channel.ID),
+		map[string]interface{}{"user_id": editor.ID, "role": models.RoleAdmin}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 3, suite.memberCount(channel.ID))
+
+	// подписчик только читает
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", channel.ID), map[string]string{"text": "можно вопрос?"}, aliceToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", channel.ID), struct{}{}, aliceToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/attachments", channel.ID),
+		map[string]interface{}{"filename": "a.txt", "mime_type": "text/plain", "size": 1}, aliceToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	conn, _, err := dialChatSocket(server, channel.ID, aliceToken)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"type": "message.create", "text": "а через сокет?"})
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventError, event.Type)
+	assert.Equal(t, problem.NotPublisher, event.Data["code"])
+
+	post := suite.postMessage(channel.ID, "Вышла новая версия", suite.token)
+	suite.postMessage(channel.ID, "Список изменений", editorToken)
+	event, err = readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessageCreated, event.Type)
+
+	var history struct {
+		models.Chat
+		Messages []models.Message `json:"messages"`
+	}
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", channel.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	json.Unmarshal(rr.Body.Bytes(), &history)
+	assert.Equal(t, 3, history.MemberCount)
+	if assert.Len(t, history.Messages, 2) {
+		assert.Equal(t, post.ID, history.Messages[0].ID)
+	}
+
+	// реакции подписчикам доступны
+	rr = performAuthRequest(suite.router, "PUT", fmt.Sprintf("/chats/%d/messages/%d/reactions/👍", channel.ID, post.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", subscriptionPath(channel.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, 2, suite.memberCount(channel.ID))
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", channel.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", subscriptionPath(channel.ID), nil, suite.token)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestChannels_MemberCount() {
+	t := suite.T()
+
+	channel := suite.createChannel("Анонсы")
+
+	var wg sync.WaitGroup
+	subscribed := make([]bool, 10)
+	for i := range subscribed {
+		_, token := createTestUser(t, fmt.Sprintf("reader%d", i))
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			// каждый подписывается дважды, второй раз счетчик не трогает
+			for j := 0; j < 2; j++ {
+				code := performAuthRequest(suite.router, "PUT", subscriptionPath(channel.ID), nil, token).Code
+				subscribed[i] = subscribed[i] || code == http.StatusOK || code == http.StatusCreated
+			}
+		}(i, token)
+	}
+	wg.Wait()
+
+	// sqlite в памяти может отбить часть параллельных записей блокировкой,
+	// поэтому сверяем счетчик с теми, кто реально подписался
+	expected := 1
+	for _, ok := range subscribed {
+		if ok {
+			expected++
+		}
+	}
+	assert.Greater(t, expected, 1)
+	members, err := testStore.Members(context.Background(), channel.ID)
+	assert.NoError(t, err)
+	assert.Len(t, members, expected)
+	assert.Equal(t, expected, suite.memberCount(channel.ID))
+
+	// у групп и личных чатов счетчик тоже ведется, но подписки нет
+	rr := performAuthRequest(suite.router, "POST", "/chats", map[string]string{"title": "Команда"}, suite.token)
+	var group models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &group)
+	bob, bobToken := createTestUser(t, "bob")
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", group.ID), map[string]uint{"user_id": bob.ID}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 2, suite.memberCount(group.ID))
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", group.ID, bob.ID), nil, bobToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, 1, suite.memberCount(group.ID))
+
+	rr = performAuthRequest(suite.router, "PUT", subscriptionPath(group.ID), nil, bobToken)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, 1, suite.memberCount(group.ID))
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", bob.ID), nil, suite.token)
+	var direct models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &direct)
+	assert.Equal(t, 2, direct.MemberCount)
+}
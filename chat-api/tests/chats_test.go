@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+type chatListResponse struct {
+	Chats []struct {
+		models.Chat
+		MessageCount  int64           `json:"message_count"`
+		LastMessage   *models.Message `json:"last_message"`
+		UnreadCount   int64           `json:"unread_count"`
+		FirstUnreadID *uint           `json:"first_unread_id"`
+		PeerID        *uint           `json:"peer_id"`
+	} `json:"chats"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+func (suite *HandlersTestSuite) listChats(query string) chatListResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", "/chats"+query, nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response chatListResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestListChats_OrderedByActivity() {
+	t := suite.T()
+
+	first := createTestChat(t, "Первый", suite.user.ID)
+	time.Sleep(time.Millisecond)
+	second := createTestChat(t, "Второй", suite.user.ID)
+	other, _ := createTestUser(t, "other")
+	createTestChat(t, "Чужой", other.ID)
+
+	// сообщение в первом чате поднимает его наверх
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", first.ID),
+		map[string]string{"text": strings.Repeat("я", 150)}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	response := suite.listChats("")
+	if assert.Len(t, response.Chats, 2) {
+		assert.Equal(t, first.ID, response.Chats[0].ID)
+		assert.Equal(t, int64(1), response.Chats[0].MessageCount)
+		if assert.NotNil(t, response.Chats[0].LastMessage) {
+			assert.Equal(t, strings.Repeat("я", 100)+"…", response.Chats[0].LastMessage.Text)
+		}
+
+		assert.Equal(t, second.ID, response.Chats[1].ID)
+		assert.Equal(t, int64(0), response.Chats[1].MessageCount)
+		assert.Nil(t, response.Chats[1].LastMessage)
+	}
+	assert.Nil(t, response.NextCursor)
+}
+
+func (suite *HandlersTestSuite) TestListChats_CursorPagination() {
+	t := suite.T()
+
+	// одинаковое время активности, порядок решает id
+	activity := time.Now()
+	var ids []uint
+	for i := 1; i <= 5; i++ {
+		chat := createTestChat(t, fmt.Sprintf("Чат %d", i), suite.user.ID)
+		chat.LastActivityAt = activity
+		saveTestChat(t, chat)
+		ids = append(ids, chat.ID)
+	}
+
+	var seen []uint
+	query := "?limit=2"
+	for page := 0; page < 5; page++ {
+		response := suite.listChats(query)
+		for _, c := range response.Chats {
+			seen = append(seen, c.ID)
+		}
+		if response.NextCursor == nil {
+			break
+		}
+		query = "?limit=2&cursor=" + *response.NextCursor
+	}
+
+	assert.Equal(t, []uint{ids[4], ids[3], ids[2], ids[1], ids[0]}, seen)
+
+	rr := performAuthRequest(suite.router, "GET", "/chats?cursor=%21%21", nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestListChats_TitlePrefix() {
+	t := suite.T()
+
+	createTestChat(t, "Support: заказ 1", suite.user.ID)
+	createTestChat(t, "support: заказ 2", suite.user.ID)
+	createTestChat(t, "Болталка", suite.user.ID)
+	createTestChat(t, "100% скидки", suite.user.ID)
+
+	response := suite.listChats("?prefix=support")
+	assert.Len(t, response.Chats, 2)
+
+	response = suite.listChats("?prefix=1%25")
+	assert.Len(t, response.Chats, 0)
+
+	response = suite.listChats("?prefix=100%25")
+	assert.Len(t, response.Chats, 1)
+}
+
+func (suite *HandlersTestSuite) TestListChats_CountsSkipThreadReplies() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Поддержка", suite.user.ID)
+	other, otherToken := createTestUser(t, "other")
+	addTestMember(t, chat.ID, other.ID, models.RoleMember)
+
+	root := suite.postMessage(chat.ID, "Вопрос", otherToken)
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]interface{}{
+		"text":      "Уточнение",
+		"parent_id": root.ID,
+	}, otherToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// тред не попадает в ленту, поэтому оба счетчика видят одно сообщение
+	response := suite.listChats("")
+	if assert.Len(t, response.Chats, 1) {
+		assert.Equal(t, int64(1), response.Chats[0].MessageCount)
+		assert.Equal(t, int64(1), response.Chats[0].UnreadCount)
+	}
+}
@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/store"
+)
+
+func (suite *HandlersTestSuite) TestDeleteMessage_LeavesTombstone() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Удаления", suite.user.ID)
+	first := suite.postMessage(chat.ID, "Первое", suite.token)
+	second := suite.postMessage(chat.ID, "Секрет", suite.token)
+	suite.postMessage(chat.ID, "Третье", suite.token)
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, second.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "Секрет")
+
+	var response struct {
+		Messages []map[string]interface{} `json:"messages"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	if assert.Len(t, response.Messages, 3) {
+		assert.Equal(t, float64(second.ID), response.Messages[1]["id"])
+		assert.Equal(t, true, response.Messages[1]["deleted"])
+		assert.Nil(t, response.Messages[0]["deleted"])
+	}
+
+	// заглушка годится как курсор истории
+	page := suite.getHistory(chat.ID, fmt.Sprintf("?before=%d", second.ID))
+	assert.Equal(t, []uint{first.ID}, messageIDs(page.Messages))
+
+	// удаленное не редактируется и не удаляется повторно
+	rr = performAuthRequest(suite.router, "PATCH", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, second.ID), map[string]string{"text": "Воскрес"}, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, second.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	list := suite.listChats("")
+	if assert.Len(t, list.Chats, 1) {
+		assert.Equal(t, int64(2), list.Chats[0].MessageCount)
+	}
+}
+
+func (suite *HandlersTestSuite) TestDeleteMessage_Permissions() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Удаления", suite.user.ID)
+	member, memberToken := createTestUser(t, "member")
+	addTestMember(t, chat.ID, member.ID, models.RoleMember)
+	admin, adminToken := createTestUser(t, "admin")
+	addTestMember(t, chat.ID, admin.ID, models.RoleAdmin)
+
+	ownerMessage := suite.postMessage(chat.ID, "От владельца", suite.token)
+	memberMessage := suite.postMessage(chat.ID, "От участника", memberToken)
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, ownerMessage.ID), nil, memberToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// автор не может стереть совсем, только мягко
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d?purge=true", chat.ID, memberMessage.ID), nil, memberToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, memberMessage.ID), nil, adminToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	// админ стирает и заглушку
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d?purge=true", chat.ID, memberMessage.ID), nil, adminToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	_, err := testStore.Message(context.Background(), chat.ID, memberMessage.ID, true)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	page := suite.getHistory(chat.ID, "")
+	assert.Equal(t, []uint{ownerMessage.ID}, messageIDs(page.Messages))
+}
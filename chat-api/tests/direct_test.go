@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+func (suite *HandlersTestSuite) TestDirectChat_OnePerPair() {
+	t := suite.T()
+
+	alice, aliceToken := createTestUser(t, "alice")
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", alice.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+	assert.Equal(t, models.ChatDirect, chat.Type)
+	assert.Empty(t, chat.Title)
+
+	// с любой стороны пары тот же чат
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", suite.user.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var same models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &same)
+	assert.Equal(t, chat.ID, same.ID)
+
+	members, err := testStore.Members(context.Background(), chat.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, models.RoleMember, members[0].Role)
+		assert.Equal(t, models.RoleMember, members[1].Role)
+	}
+
+	list := suite.listChats("")
+	if assert.Len(t, list.Chats, 1) {
+		assert.Equal(t, models.ChatDirect, list.Chats[0].Type)
+		if assert.NotNil(t, list.Chats[0].PeerID) {
+			assert.Equal(t, alice.ID, *list.Chats[0].PeerID)
+		}
+	}
+
+	var detail struct {
+		PeerID *uint `json:"peer_id"`
+	}
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, aliceToken)
+	json.Unmarshal(rr.Body.Bytes(), &detail)
+	if assert.NotNil(t, detail.PeerID) {
+		assert.Equal(t, suite.user.ID, *detail.PeerID)
+	}
+
+	// хранилищу тоже не дать завести второй чат паре
+	low, high := suite.user.ID, alice.ID
+	if low > high {
+		low, high = high, low
+	}
+	err = testStore.CreateChat(context.Background(), &models.Chat{Type: models.ChatDirect, DirectUser1ID: &low, DirectUser2ID: &high}, nil)
+	assert.Error(t, err)
+}
+
+func (suite *HandlersTestSuite) TestDirectChat_Delete() {
+	t := suite.T()
+
+	alice, aliceToken := createTestUser(t, "alice")
+	_, strangerToken := createTestUser(t, "stranger")
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", suite.user.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+
+	// владельца у личного чата нет, удалить может любой из собеседников, но не посторонний
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code, rr.Body.String())
+	assert.Empty(t, suite.listChats("").Chats)
+
+	// после удаления пара может начать переписку заново
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", alice.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var again models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &again)
+	assert.NotEqual(t, chat.ID, again.ID)
+}
+
+func (suite *HandlersTestSuite) TestDirectChat_Concurrent() {
+	t := suite.T()
+
+	bob, _ := createTestUser(t, "bob")
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", bob.ID), nil, suite.token).Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Contains(t, []int{http.StatusOK, http.StatusCreated}, code)
+	}
+	assert.Len(t, suite.listChats("").Chats, 1)
+}
+
+func (suite *HandlersTestSuite) TestDirectChat_Validation() {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", suite.user.ID), nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", "/dm/999999", nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// через POST /chats личный чат не создать, а тип проверяется
+	rr = performAuthRequest(suite.router, "POST", "/chats", map[string]string{"type": "direct", "title": "alice-bob"}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", "/chats", map[string]string{"type": "broadcast", "title": "Новости"}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// состав личного чата не меняется
+	carol, carolToken := createTestUser(t, "carol")
+	dave, _ := createTestUser(t, "dave")
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", carol.ID), nil, suite.token)
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]uint{"user_id": dave.ID}, suite.token)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, carol.ID), nil, carolToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestDirectChat_DatabaseDown() {
+	t := suite.T()
+
+	alice, _ := createTestUser(t, "alice")
+
+	// сбой базы не выдается за несуществующего пользователя
+	h := newTestHandler()
+	h.Users = brokenStore{UserStore: testStore}
+	rr := performAuthRequest(createRouterWith(h), "POST", fmt.Sprintf("/dm/%d", alice.ID), nil, suite.token)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
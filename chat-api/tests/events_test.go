@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/realtime"
+)
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// readSSE читает одно событие, пропуская комментарии
+func readSSE(reader *bufio.Reader) (sseEvent, error) {
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return event, err
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if event.Event != "" {
+				return event, nil
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.ID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.Event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.Data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEventStream(server *httptest.Server, chatID uint, token, lastEventID string) (*http.Response, error) {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/chats/%d/events", server.URL, chatID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+func (suite *HandlersTestSuite) TestChatEvents_ResumeAndLive() {
+	t := suite.T()
+
+	// короткий WriteTimeout не должен обрывать поток
+	server := httptest.NewUnstartedServer(suite.router)
+	server.Config.WriteTimeout = 300 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	chat := createTestChat(t, "Поток", suite.user.ID)
+	first := createTestMessage(t, chat.ID, "Уже прочитано")
+	second := createTestMessage(t, chat.ID, "Пропущено 1")
+	third := createTestMessage(t, chat.ID, "Пропущено 2")
+
+	resp, err := openEventStream(server, chat.ID, suite.token, fmt.Sprint(first.ID))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []uint{second.ID, third.ID} {
+		event, err := readSSE(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, realtime.EventMessageCreated, event.Event)
+		assert.Equal(t, fmt.Sprint(expected), event.ID)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]string{"text": "Новое"}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	event, err := readSSE(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessageCreated, event.Event)
+	assert.Contains(t, event.Data, `"text":"Новое"`)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	event, err = readSSE(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventChatDeleted, event.Event)
+	assert.Empty(t, event.ID)
+
+	// после удаления чата поток закрывается
+	_, err = readSSE(reader)
+	assert.Error(t, err)
+}
+
+func (suite *HandlersTestSuite) TestChatEvents_Validation() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Поток", suite.user.ID)
+	_, strangerToken := createTestUser(t, "stranger")
+
+	resp, err := openEventStream(server, chat.ID, strangerToken, "")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	resp, err = openEventStream(server, chat.ID, suite.token, "abc")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func (suite *HandlersTestSuite) TestChatEvents_ClosedOnLeave() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Поток", suite.user.ID)
+	member, memberToken := createTestUser(t, "member")
+	addTestMember(t, chat.ID, member.ID, models.RoleMember)
+
+	resp, err := openEventStream(server, chat.ID, memberToken, "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, member.ID), nil, memberToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	reader := bufio.NewReader(resp.Body)
+	event, err := readSSE(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMemberRemoved, event.Event)
+
+	// вышедший участник больше не получает событий чата
+	_, err = readSSE(reader)
+	assert.Error(t, err)
+}
@@ -2,10 +2,12 @@ package tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -19,13 +21,43 @@ import (
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"chat-api/internal/auth"
+	"chat-api/internal/config"
+	"chat-api/internal/emoji"
 	"chat-api/internal/handlers"
 	"chat-api/internal/middleware"
 	"chat-api/internal/models"
+	"chat-api/internal/presence"
+	"chat-api/internal/realtime"
+	"chat-api/internal/storage"
+	"chat-api/internal/store"
 )
 
 var testDB *gorm.DB
 
+// testStore хранилище текущего прогона набора: gorm поверх testDB или память
+var testStore store.Store
+
+var testConfig = &config.Config{
+	JWTKeys:  []config.JWTKey{{ID: "test", Algorithm: "HS256", Secret: "test-secret-test-secret-test-secret"}},
+	TokenTTL: time.Hour,
+}
+
+var testIssuer *auth.Issuer
+
+// вложения в тестах пишутся во временный каталог
+var (
+	testBlobDir string
+	testBlobs   *storage.Local
+)
+
+const testUploadLimit = 1 << 20
+
+const testPinLimit = 3
+
+// короткий ttl чтобы тесты дожидались истечения отметки "печатает"
+const testTypingTTL = 200 * time.Millisecond
+
 func TestMain(m *testing.M) {
 	setupTestDatabase()
 	code := m.Run()
@@ -35,6 +67,11 @@ func TestMain(m *testing.M) {
 
 func setupTestDatabase() {
 	var err error
+	testIssuer, err = auth.NewIssuer(testConfig)
+	if err != nil {
+		log.Fatal("Failed to create test token issuer:", err)
+	}
+
 	testDB, err = gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
 	if err != nil {
 		log.Fatal("Failed to connect to test database:", err)
@@ -47,38 +84,97 @@ func setupTestDatabase() {
 		}
 	}
 
-	err = testDB.AutoMigrate(&models.Chat{}, &models.Message{})
+	err = testDB.AutoMigrate(&models.User{}, &models.Chat{}, &models.Message{}, &models.ChatMember{}, &models.MessageRevision{}, &models.MessageReaction{}, &models.Attachment{}, &models.AttachmentThumbnail{}, &models.AttachmentJob{}, &models.MessageMention{}, &models.MessagePin{})
 	if err != nil {
 		log.Fatal("Failed to migrate test database:", err)
 	}
+	if err := createSearchIndex(); err != nil {
+		log.Fatal("Failed to create search index:", err)
+	}
+
+	testBlobDir, err = os.MkdirTemp("", "chat-api-blobs-")
+	if err != nil {
+		log.Fatal("Failed to create blob dir:", err)
+	}
+	testBlobs, err = storage.NewLocal(testBlobDir)
+	if err != nil {
+		log.Fatal("Failed to create blob store:", err)
+	}
 
 	log.Println("Test database setup completed (foreign keys enabled)")
 }
 
+// createSearchIndex замена tsvector из миграции для sqlite: fts4 таблица поверх messages,
+// fts5 в go-sqlite3 есть только с build тегом
+func createSearchIndex() error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE messages_fts USING fts4(content="messages", text, tokenize=unicode61)`,
+		`CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+			INSERT INTO messages_fts(docid, text) VALUES (new.id, new.text);
+		END`,
+		`CREATE TRIGGER messages_fts_before_update BEFORE UPDATE ON messages BEGIN
+			DELETE FROM messages_fts WHERE docid = old.id;
+		END`,
+		`CREATE TRIGGER messages_fts_after_update AFTER UPDATE ON messages BEGIN
+			INSERT INTO messages_fts(docid, text) VALUES (new.id, new.text);
+		END`,
+		`CREATE TRIGGER messages_fts_delete BEFORE DELETE ON messages BEGIN
+			DELETE FROM messages_fts WHERE docid = old.id;
+		END`,
+	}
+	for _, statement := range statements {
+		if err := testDB.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func cleanupTestDatabase() {
 	sqlDB, err := testDB.DB()
 	if err == nil {
 		sqlDB.Close()
 	}
+	os.RemoveAll(testBlobDir)
 	log.Println("Test database cleanup completed")
 }
-func createTestRouter() *mux.Router {
+func createTestRouter() http.Handler {
+	return createRouterWith(newTestHandler())
+}
+
+// createRouterWith маршруты поверх готового обработчика, чтобы подменить в нем хранилища.
+// обвязка как в main.go: RequestID и логи на всем сервере, а не только на найденных маршрутах
+func createRouterWith(h *handlers.Handler) http.Handler {
 	r := mux.NewRouter()
-	r.Use(middleware.Logging)
+	r.Use(middleware.Route)
 	r.Use(middleware.JSONContentType)
+	handlers.InitHandlers(r, h)
+	return middleware.RequestID(middleware.Logging(slog.Default())(r))
+}
 
-	h := &handlers.Handler{DB: testDB}
-
-	r.HandleFunc("/chats", h.CreateChat).Methods("POST")
-	r.HandleFunc("/chats/{id}/messages", h.CreateMessage).Methods("POST")
-	r.HandleFunc("/chats/{id}", h.GetChat).Methods("GET")
-	r.HandleFunc("/chats/{id}", h.DeleteChat).Methods("DELETE")
-	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
-
-	return r
+func newTestHandler() *handlers.Handler {
+	return &handlers.Handler{
+		Users:       testStore,
+		Chats:       testStore,
+		Messages:    testStore,
+		Attachments: testStore,
+		Auth:        testIssuer,
+		Hub:         realtime.NewHub(),
+		Emoji:       emoji.NewRegistry([]string{"party_parrot"}),
+		Presence:    presence.NewMemoryStore(),
+		TypingTTL:   testTypingTTL,
+		OnlineTTL:   time.Minute,
+		Blobs:       testBlobs,
+		UploadLimit: testUploadLimit,
+		PinLimit:    testPinLimit,
+	}
 }
 
 func performRequest(r http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	return performAuthRequest(r, method, path, body, "")
+}
+
+func performAuthRequest(r http.Handler, method, path string, body interface{}, token string) *httptest.ResponseRecorder {
 	var reqBody io.Reader
 	if body != nil {
 		jsonBody, _ := json.Marshal(body)
@@ -89,6 +185,9 @@ func performRequest(r http.Handler, method, path string, body interface{}) *http
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	rr := httptest.NewRecorder()
 	r.ServeHTTP(rr, req)
@@ -96,19 +195,48 @@ func performRequest(r http.Handler, method, path string, body interface{}) *http
 	return rr
 }
 
-func createTestChat(t assert.TestingT, title string) *models.Chat {
+func createTestUser(t assert.TestingT, username string) (*models.User, string) {
+	user := &models.User{
+		Username:     username,
+		PasswordHash: "x",
+		CreatedAt:    time.Now(),
+	}
+
+	assert.NoError(t, testStore.CreateUser(context.Background(), user))
+
+	token, err := testIssuer.Issue(user.ID)
+	assert.NoError(t, err)
+
+	return user, token
+}
+
+func createTestChat(t assert.TestingT, title string, ownerID uint) *models.Chat {
+	now := time.Now()
 	chat := &models.Chat{
-		Title:     title,
-		CreatedAt: time.Now(),
+		Title:          title,
+		CreatedAt:      now,
+		LastActivityAt: now,
 	}
 
-	result := testDB.Create(chat)
-	assert.NoError(t, result.Error)
+	err := testStore.CreateChat(context.Background(), chat, []models.ChatMember{
+		{UserID: ownerID, Role: models.RoleOwner, CreatedAt: now},
+	})
+	assert.NoError(t, err)
 	assert.NotZero(t, chat.ID)
 
 	return chat
 }
 
+func addTestMember(t assert.TestingT, chatID, userID uint, role string) {
+	err := testStore.AddMember(context.Background(), &models.ChatMember{
+		ChatID:    chatID,
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: time.Now(),
+	})
+	assert.NoError(t, err)
+}
+
 func createTestMessage(t assert.TestingT, chatID uint, text string) *models.Message {
 	message := &models.Message{
 		ChatID:    chatID,
@@ -116,8 +244,7 @@ func createTestMessage(t assert.TestingT, chatID uint, text string) *models.Mess
 		CreatedAt: time.Now(),
 	}
 
-	result := testDB.Create(message)
-	assert.NoError(t, result.Error)
+	saveTestMessage(t, message)
 	assert.NotZero(t, message.ID)
 
 	time.Sleep(time.Millisecond)
@@ -125,21 +252,71 @@ func createTestMessage(t assert.TestingT, chatID uint, text string) *models.Mess
 	return message
 }
 
+// saveTestMessage сохраняет сообщение как есть, мимо обработчиков: со своим временем,
+// удаленным или без счетчиков ветки
+func saveTestMessage(t assert.TestingT, message *models.Message) {
+	if memory, ok := testStore.(*store.MemoryStore); ok {
+		memory.AddMessage(message)
+		return
+	}
+	assert.NoError(t, testDB.Save(message).Error)
+}
+
+// saveTestChat сохраняет чат как есть, например со своим временем активности
+func saveTestChat(t assert.TestingT, chat *models.Chat) {
+	if memory, ok := testStore.(*store.MemoryStore); ok {
+		memory.AddChat(chat)
+		return
+	}
+	assert.NoError(t, testDB.Save(chat).Error)
+}
+
 type HandlersTestSuite struct {
 	suite.Suite
-	router *mux.Router
+	memory bool // прогон на store.MemoryStore, без базы
+	router http.Handler
+	user   *models.User
+	token  string
 }
 
 func (suite *HandlersTestSuite) SetupTest() {
+	if suite.memory {
+		testStore = store.NewMemoryStore()
+	} else {
+		testStore = store.NewGormStore(testDB)
+	}
 	suite.router = createTestRouter()
+	testDB.Exec("DELETE FROM message_pins")
+	testDB.Exec("DELETE FROM message_mentions")
+	testDB.Exec("DELETE FROM attachment_jobs")
+	testDB.Exec("DELETE FROM attachment_thumbnails")
+	testDB.Exec("DELETE FROM attachments")
+	testDB.Exec("DELETE FROM message_reactions")
+	testDB.Exec("DELETE FROM message_revisions")
+	testDB.Exec("DELETE FROM chat_members")
 	testDB.Exec("DELETE FROM messages")
 	testDB.Exec("DELETE FROM chats")
+	testDB.Exec("DELETE FROM users")
+
+	suite.user, suite.token = createTestUser(suite.T(), "tester")
 }
 
 func TestHandlersTestSuite(t *testing.T) {
 	suite.Run(t, new(HandlersTestSuite))
 }
 
+// обработчики не знают, где лежат данные, так что весь набор проходит и без базы
+func TestHandlersTestSuite_Memory(t *testing.T) {
+	suite.Run(t, &HandlersTestSuite{memory: true})
+}
+
+// requireDB пропускает тест в прогоне на памяти: он проверяет саму базу или фоновую обработку
+func (suite *HandlersTestSuite) requireDB() {
+	if suite.memory {
+		suite.T().Skip("нужна база")
+	}
+}
+
 func (suite *HandlersTestSuite) TestHealthCheck() {
 	t := suite.T()
 
@@ -160,7 +337,7 @@ func (suite *HandlersTestSuite) TestCreateChat_Success() {
 		"title": "Новый чат",
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats", requestBody)
+	rr := performAuthRequest(suite.router, "POST", "/chats", requestBody, suite.token)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
@@ -168,6 +345,7 @@ func (suite *HandlersTestSuite) TestCreateChat_Success() {
 	err := json.Unmarshal(rr.Body.Bytes(), &chat)
 	assert.NoError(t, err)
 	assert.Equal(t, "Новый чат", chat.Title)
+	assert.Equal(t, models.ChatGroup, chat.Type)
 	assert.NotZero(t, chat.ID)
 	assert.NotZero(t, chat.CreatedAt)
 }
@@ -179,7 +357,7 @@ func (suite *HandlersTestSuite) TestCreateChat_EmptyTitle() {
 		"title": "",
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats", requestBody)
+	rr := performAuthRequest(suite.router, "POST", "/chats", requestBody, suite.token)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
@@ -191,7 +369,7 @@ func (suite *HandlersTestSuite) TestCreateChat_TooLongTitle() {
 		"title": longTitle,
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats", requestBody)
+	rr := performAuthRequest(suite.router, "POST", "/chats", requestBody, suite.token)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
@@ -202,7 +380,7 @@ func (suite *HandlersTestSuite) TestCreateChat_TrimSpaces() {
 		"title": "  Чат с пробелами  ",
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats", requestBody)
+	rr := performAuthRequest(suite.router, "POST", "/chats", requestBody, suite.token)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
@@ -215,88 +393,112 @@ func (suite *HandlersTestSuite) TestCreateChat_TrimSpaces() {
 func (suite *HandlersTestSuite) TestCreateMessage_Success() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат для сообщения")
+	user, token := createTestUser(t, "author")
+	chat := createTestChat(t, "Чат для сообщения", user.ID)
 
 	requestBody := map[string]string{
 		"text": "Тестик",
 	}
 
-	rr := performRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody)
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody, token)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
 	var message models.Message
 	err := json.Unmarshal(rr.Body.Bytes(), &message)
 	assert.NoError(t, err)
-	assert.Equal(t, "Тестовое сообщение", message.Text)
+	assert.Equal(t, "Тестик", message.Text)
 	assert.Equal(t, chat.ID, message.ChatID)
 	assert.NotZero(t, message.ID)
+	if assert.NotNil(t, message.AuthorID) {
+		assert.Equal(t, user.ID, *message.AuthorID)
+	}
+}
+
+func (suite *HandlersTestSuite) TestCreateMessage_Unauthorized() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Чат", suite.user.ID)
+
+	requestBody := map[string]string{
+		"text": "Аноним",
+	}
+
+	rr := performRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody, "garbage")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
 }
 
 func (suite *HandlersTestSuite) TestCreateMessage_ChatNotFound() {
 	t := suite.T()
 
+	_, token := createTestUser(t, "author")
+
 	requestBody := map[string]string{
 		"text": "Сообщение",
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats/999/messages", requestBody)
+	rr := performAuthRequest(suite.router, "POST", "/chats/999/messages", requestBody, token)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func (suite *HandlersTestSuite) TestCreateMessage_EmptyText() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат")
+	author, token := createTestUser(t, "author")
+	chat := createTestChat(t, "Чат", author.ID)
 
 	requestBody := map[string]string{
 		"text": "",
 	}
 
-	rr := performRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody)
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody, token)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
 func (suite *HandlersTestSuite) TestCreateMessage_TooLongText() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат")
+	author, token := createTestUser(t, "author")
+	chat := createTestChat(t, "Чат", author.ID)
 
 	longText := strings.Repeat("a", 5001)
 	requestBody := map[string]string{
 		"text": longText,
 	}
 
-	rr := performRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody)
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), requestBody, token)
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 func (suite *HandlersTestSuite) TestGetChat_Success() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат с сообщениями")
+	chat := createTestChat(t, "Чат с сообщениями", suite.user.ID)
 
 	message1 := &models.Message{
 		ChatID:    chat.ID,
 		Text:      "Первое сообщение",
 		CreatedAt: time.Now().Add(-2 * time.Hour),
 	}
-	testDB.Create(message1)
+	saveTestMessage(t, message1)
 
 	message2 := &models.Message{
 		ChatID:    chat.ID,
 		Text:      "Второе сообщение",
 		CreatedAt: time.Now().Add(-1 * time.Hour),
 	}
-	testDB.Create(message2)
+	saveTestMessage(t, message2)
 
 	message3 := &models.Message{
 		ChatID:    chat.ID,
 		Text:      "Третье сообщение",
 		CreatedAt: time.Now(),
 	}
-	testDB.Create(message3)
+	saveTestMessage(t, message3)
 
-	rr := performRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil)
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -349,7 +551,7 @@ func (suite *HandlersTestSuite) TestGetChat_Success() {
 func (suite *HandlersTestSuite) TestGetChat_WithLimit() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат с лимитом")
+	chat := createTestChat(t, "Чат с лимитом", suite.user.ID)
 
 	for i := 1; i <= 15; i++ {
 		message := &models.Message{
@@ -357,12 +559,11 @@ func (suite *HandlersTestSuite) TestGetChat_WithLimit() {
 			Text:      fmt.Sprintf("Сообщение %d", i),
 			CreatedAt: time.Now().Add(time.Duration(i) * time.Millisecond),
 		}
-		result := testDB.Create(message)
-		assert.NoError(t, result.Error)
+		saveTestMessage(t, message)
 		time.Sleep(time.Millisecond)
 	}
 
-	rr := performRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?limit=5", chat.ID), nil)
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?limit=5", chat.ID), nil, suite.token)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 
@@ -384,51 +585,46 @@ func (suite *HandlersTestSuite) TestGetChat_WithLimit() {
 func (suite *HandlersTestSuite) TestGetChat_NotFound() {
 	t := suite.T()
 
-	rr := performRequest(suite.router, "GET", "/chats/999", nil)
+	rr := performAuthRequest(suite.router, "GET", "/chats/999", nil, suite.token)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 
 func (suite *HandlersTestSuite) TestDeleteChat_Success() {
 	t := suite.T()
 
-	chat := createTestChat(t, "Чат удаления")
-	createTestMessage(t, chat.ID, "Сообщение 1")
-	createTestMessage(t, chat.ID, "Сообщение 2")
-
-	var chatCount, messageCount int64
-	testDB.Model(&models.Chat{}).Where("id = ?", chat.ID).Count(&chatCount)
-	testDB.Model(&models.Message{}).Where("chat_id = ?", chat.ID).Count(&messageCount)
+	chat := createTestChat(t, "Чат удаления", suite.user.ID)
+	message1 := createTestMessage(t, chat.ID, "Сообщение 1")
+	message2 := createTestMessage(t, chat.ID, "Сообщение 2")
+	ctx := context.Background()
 
-	assert.Equal(t, int64(1), chatCount)
-	assert.Equal(t, int64(2), messageCount, "2 сообщения перед удалением")
-
-	rr := performRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil)
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
 	assert.Equal(t, http.StatusNoContent, rr.Code)
 
-	testDB.Model(&models.Chat{}).Where("id = ?", chat.ID).Count(&chatCount)
-	assert.Equal(t, int64(0), chatCount, "чат должен быть удален")
+	_, err := testStore.Chat(ctx, chat.ID)
+	assert.ErrorIs(t, err, store.ErrNotFound, "чат должен быть удален")
 
-	//  SQLite работает только если включены foreign keys
-	testDB.Model(&models.Message{}).Where("chat_id = ?", chat.ID).Count(&messageCount)
-	if messageCount > 0 {
-		t.Logf("каскадное удаление может не работать без foreign keys")
+	for _, message := range []*models.Message{message1, message2} {
+		_, err := testStore.Message(ctx, chat.ID, message.ID, true)
+		assert.ErrorIs(t, err, store.ErrNotFound, "сообщения удаляются вместе с чатом")
 	}
 }
 
 func (suite *HandlersTestSuite) TestDeleteChat_NotFound() {
 	t := suite.T()
 
-	rr := performRequest(suite.router, "DELETE", "/chats/999", nil)
+	rr := performAuthRequest(suite.router, "DELETE", "/chats/999", nil, suite.token)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
 func (suite *HandlersTestSuite) TestFullChatFlow() {
 	t := suite.T()
 
+	user, token := suite.user, suite.token
+
 	createRequest := map[string]string{
 		"title": "Интеграционный чат",
 	}
 
-	rr := performRequest(suite.router, "POST", "/chats", createRequest)
+	rr := performAuthRequest(suite.router, "POST", "/chats", createRequest, suite.token)
 	assert.Equal(t, http.StatusCreated, rr.Code)
 
 	var chat models.Chat
@@ -438,12 +634,12 @@ func (suite *HandlersTestSuite) TestFullChatFlow() {
 	messages := []string{"Привет", "Как дела?", "Все хорошо"}
 	for _, text := range messages {
 		msgRequest := map[string]string{"text": text}
-		rr = performRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chatID), msgRequest)
+		rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chatID), msgRequest, token)
 		assert.Equal(t, http.StatusCreated, rr.Code)
 		time.Sleep(time.Millisecond)
 	}
 
-	rr = performRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?limit=10", chatID), nil)
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?limit=10", chatID), nil, suite.token)
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	var getResponse struct {
@@ -454,10 +650,15 @@ func (suite *HandlersTestSuite) TestFullChatFlow() {
 
 	assert.Equal(t, "Интеграционный чат", getResponse.Title)
 	assert.Len(t, getResponse.Messages, 3)
+	for _, msg := range getResponse.Messages {
+		if assert.NotNil(t, msg.AuthorID) {
+			assert.Equal(t, user.ID, *msg.AuthorID)
+		}
+	}
 
-	rr = performRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chatID), nil)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chatID), nil, suite.token)
 	assert.Equal(t, http.StatusNoContent, rr.Code)
 
-	rr = performRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chatID), nil)
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chatID), nil, suite.token)
 	assert.Equal(t, http.StatusNotFound, rr.Code)
 }
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+type historyResponse struct {
+	models.Chat
+	Messages          []models.Message `json:"messages"`
+	PrevCursor        *uint            `json:"prev_cursor"`
+	NextCursor        *uint            `json:"next_cursor"`
+	LastReadMessageID *uint            `json:"last_read_message_id"`
+	UnreadCount       int64            `json:"unread_count"`
+	FirstUnreadID     *uint            `json:"first_unread_id"`
+}
+
+// createHistory создает n сообщений с одинаковым временем, порядок задает только id
+func createHistory(t assert.TestingT, chatID uint, n int) []uint {
+	createdAt := time.Now()
+	ids := make([]uint, n)
+	for i := 0; i < n; i++ {
+		message := &models.Message{ChatID: chatID, Text: fmt.Sprintf("Сообщение %d", i+1), CreatedAt: createdAt}
+		saveTestMessage(t, message)
+		ids[i] = message.ID
+	}
+	return ids
+}
+
+func (suite *HandlersTestSuite) getHistory(chatID uint, query string) historyResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d%s", chatID, query), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response historyResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	return response
+}
+
+func messageIDs(messages []models.Message) []uint {
+	ids := make([]uint, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+	return ids
+}
+
+func (suite *HandlersTestSuite) TestGetChat_ScrollBack() {
+	t := suite.T()
+
+	chat := createTestChat(t, "История", suite.user.ID)
+	ids := createHistory(t, chat.ID, 10)
+
+	page := suite.getHistory(chat.ID, "?limit=4")
+	assert.Equal(t, ids[6:], messageIDs(page.Messages))
+	assert.Nil(t, page.NextCursor)
+	if assert.NotNil(t, page.PrevCursor) {
+		assert.Equal(t, ids[6], *page.PrevCursor)
+	}
+
+	page = suite.getHistory(chat.ID, fmt.Sprintf("?limit=4&before=%d", *page.PrevCursor))
+	assert.Equal(t, ids[2:6], messageIDs(page.Messages))
+	assert.NotNil(t, page.NextCursor)
+
+	page = suite.getHistory(chat.ID, fmt.Sprintf("?limit=4&before=%d", *page.PrevCursor))
+	assert.Equal(t, ids[:2], messageIDs(page.Messages))
+	assert.Nil(t, page.PrevCursor)
+	if assert.NotNil(t, page.NextCursor) {
+		assert.Equal(t, ids[1], *page.NextCursor)
+	}
+}
+
+func (suite *HandlersTestSuite) TestGetChat_AfterAndAround() {
+	t := suite.T()
+
+	chat := createTestChat(t, "История", suite.user.ID)
+	ids := createHistory(t, chat.ID, 10)
+
+	page := suite.getHistory(chat.ID, fmt.Sprintf("?limit=3&after=%d", ids[2]))
+	assert.Equal(t, ids[3:6], messageIDs(page.Messages))
+	assert.NotNil(t, page.PrevCursor)
+	assert.NotNil(t, page.NextCursor)
+
+	page = suite.getHistory(chat.ID, fmt.Sprintf("?limit=5&after=%d", ids[6]))
+	assert.Equal(t, ids[7:], messageIDs(page.Messages))
+	assert.Nil(t, page.NextCursor)
+
+	page = suite.getHistory(chat.ID, fmt.Sprintf("?limit=5&around=%d", ids[5]))
+	assert.Equal(t, ids[3:8], messageIDs(page.Messages))
+	assert.NotNil(t, page.PrevCursor)
+	assert.NotNil(t, page.NextCursor)
+
+	page = suite.getHistory(chat.ID, fmt.Sprintf("?limit=5&around=%d", ids[0]))
+	assert.Equal(t, ids[:3], messageIDs(page.Messages))
+	assert.Nil(t, page.PrevCursor)
+}
+
+func (suite *HandlersTestSuite) TestGetChat_InvalidCursor() {
+	t := suite.T()
+
+	chat := createTestChat(t, "История", suite.user.ID)
+	ids := createHistory(t, chat.ID, 3)
+	other := createTestChat(t, "Другой", suite.user.ID)
+	otherIDs := createHistory(t, other.ID, 1)
+
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?before=%d&after=%d", chat.ID, ids[1], ids[0]), nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?before=abc", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// курсор из другого чата не принимается
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d?before=%d", chat.ID, otherIDs[0]), nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
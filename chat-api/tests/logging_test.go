@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/config"
+	"chat-api/internal/handlers"
+	"chat-api/internal/middleware"
+	"chat-api/internal/presence"
+)
+
+// logBuffer собирает строки логов, пишут в него и обработчики вебсокетов из своих горутин
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// entries разобранные json строки логов
+func (b *logBuffer) entries() []map[string]interface{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var entry map[string]interface{}
+		if json.Unmarshal([]byte(line), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func loggingRouter(logs *logBuffer) http.Handler {
+	return loggingRouterWith(logs, newTestHandler())
+}
+
+// loggingRouterWith и запросы, и сообщения самих обработчиков пишутся в logs
+func loggingRouterWith(logs *logBuffer, h *handlers.Handler) http.Handler {
+	logger := slog.New(slog.NewJSONHandler(logs, nil))
+	h.Logger = logger
+	r := mux.NewRouter()
+	r.Use(middleware.Route)
+	r.Use(middleware.JSONContentType)
+	handlers.InitHandlers(r, h)
+	return middleware.RequestID(middleware.Logging(logger)(r))
+}
+
+// brokenPresence хранилище присутствия, которое всегда отказывает
+type brokenPresence struct{}
+
+func (brokenPresence) Touch(context.Context, presence.Kind, uint, uint, time.Duration) error {
+	return errStoreDown
+}
+
+func (brokenPresence) Clear(context.Context, presence.Kind, uint, uint) error {
+	return errStoreDown
+}
+
+func (brokenPresence) Users(context.Context, presence.Kind, uint) ([]uint, error) {
+	return nil, errStoreDown
+}
+
+func (suite *HandlersTestSuite) TestLogging_RequestFields() {
+	t := suite.T()
+
+	logs := &logBuffer{}
+	router := loggingRouter(logs)
+	chat := createTestChat(t, "Логи", suite.user.ID)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/chats/%d?access_token=%s", chat.ID, suite.token), nil)
+	req.Header.Set("X-Request-ID", "trace-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "trace-1", rr.Header().Get("X-Request-ID"))
+
+	req = httptest.NewRequest("GET", "/chats/999999", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	missing := httptest.NewRecorder()
+	router.ServeHTTP(missing, req)
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+
+	entries := logs.entries()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	entry := entries[0]
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "trace-1", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, fmt.Sprintf("/chats/%d", chat.ID), entry["path"])
+	assert.Equal(t, "/chats/{id}", entry["route"])
+	assert.Equal(t, float64(http.StatusOK), entry["status"])
+	assert.Equal(t, float64(rr.Body.Len()), entry["bytes"])
+	assert.Contains(t, entry, "latency_ms")
+	assert.Equal(t, "192.0.2.1", entry["remote_ip"])
+	// токен из query в лог не попадает
+	assert.NotContains(t, logs.String(), suite.token)
+
+	// без входящего ид в лог идет сгенерированный, тот же что в ответе
+	assert.Equal(t, missing.Header().Get("X-Request-ID"), entries[1]["request_id"])
+	assert.Equal(t, float64(http.StatusNotFound), entries[1]["status"])
+	assert.Equal(t, float64(missing.Body.Len()), entries[1]["bytes"])
+}
+
+func (suite *HandlersTestSuite) TestLogging_HandlerErrors() {
+	t := suite.T()
+
+	logs := &logBuffer{}
+	h := newTestHandler()
+	h.Presence = brokenPresence{}
+	router := loggingRouterWith(logs, h)
+	chat := createTestChat(t, "Логи", suite.user.ID)
+
+	// сбой присутствия сообщение не ломает, только попадает в лог с ид запроса
+	req := httptest.NewRequest("POST", fmt.Sprintf("/chats/%d/messages", chat.ID), strings.NewReader(`{"text":"привет"}`))
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	req.Header.Set("X-Request-ID", "trace-2")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	entries := logs.entries()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	entry := entries[0]
+	assert.Equal(t, "presence update failed", entry["msg"])
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "trace-2", entry["request_id"])
+	assert.Equal(t, "typing", entry["kind"])
+	assert.Equal(t, float64(chat.ID), entry["chat_id"])
+	assert.Equal(t, errStoreDown.Error(), entry["error"])
+	assert.Equal(t, "request", entries[1]["msg"])
+}
+
+func (suite *HandlersTestSuite) TestLogging_UnmatchedRoutes() {
+	t := suite.T()
+
+	logs := &logBuffer{}
+	router := loggingRouter(logs)
+
+	// 404 и 405 отдает сам роутер, мимо мидлваров маршрутов, но в лог они попадают
+	missing := performAuthRequest(router, "GET", "/nowhere/42", nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+	wrongMethod := performAuthRequest(router, "PATCH", "/chats", nil, suite.token)
+	assert.Equal(t, http.StatusMethodNotAllowed, wrongMethod.Code)
+
+	entries := logs.entries()
+	if !assert.Len(t, entries, 2) {
+		return
+	}
+	for i, rr := range []*httptest.ResponseRecorder{missing, wrongMethod} {
+		assert.Equal(t, "unmatched", entries[i]["route"])
+		assert.Equal(t, float64(rr.Code), entries[i]["status"])
+		assert.Equal(t, rr.Header().Get("X-Request-ID"), entries[i]["request_id"])
+	}
+	assert.Equal(t, "/nowhere/42", entries[0]["path"])
+}
+
+func (suite *HandlersTestSuite) TestLogging_WebSocket() {
+	t := suite.T()
+
+	logs := &logBuffer{}
+	server := httptest.NewServer(loggingRouter(logs))
+	defer server.Close()
+	chat := createTestChat(t, "Сокеты", suite.user.ID)
+
+	// соединение забирается из-под обертки логов
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	conn.Close()
+
+	// обрыв без close фрейма обработчик тоже пишет в лог, с тем же ид запроса
+	byMessage := make(map[string]map[string]interface{})
+	assert.Eventually(t, func() bool {
+		for _, entry := range logs.entries() {
+			byMessage[entry["msg"].(string)] = entry
+		}
+		return byMessage["request"] != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	if request := byMessage["request"]; request != nil {
+		assert.Equal(t, "/chats/{id}/ws", request["route"])
+		assert.Equal(t, float64(http.StatusSwitchingProtocols), request["status"])
+		if readError := byMessage["websocket read error"]; assert.NotNil(t, readError) {
+			assert.Equal(t, request["request_id"], readError["request_id"])
+			assert.Equal(t, float64(chat.ID), readError["chat_id"])
+		}
+	}
+}
+
+func (suite *HandlersTestSuite) TestLogging_RedactedDSN() {
+	t := suite.T()
+
+	cfg := &config.Config{DBHost: "db", DBPort: "5432", DBUser: "chat", DBPassword: "s3cret", DBName: "chatdb"}
+	assert.Contains(t, cfg.GetDSN(), "s3cret")
+	assert.NotContains(t, cfg.RedactedDSN(), "s3cret")
+	assert.Contains(t, cfg.RedactedDSN(), "user=chat")
+}
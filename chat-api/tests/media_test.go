@@ -0,0 +1,370 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/jobs"
+	"chat-api/internal/media"
+	"chat-api/internal/models"
+)
+
+// координаты из тестового EXIF: 55/1, 45/1, 1234/100
+var testGPSLatitude = []byte{
+	55, 0, 0, 0, 1, 0, 0, 0,
+	45, 0, 0, 0, 1, 0, 0, 0,
+	0xD2, 0x04, 0, 0, 100, 0, 0, 0,
+}
+
+// testEXIF блок Exif (little endian): в IFD0 Orientation и ссылка на GPS IFD,
+// в GPS широта с полушарием
+func testEXIF(orientation uint16) []byte {
+	le := binary.LittleEndian
+	tiff := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	entry := func(tag, typ uint16, count uint32, value []byte) []byte {
+		e := make([]byte, 12)
+		le.PutUint16(e, tag)
+		le.PutUint16(e[2:], typ)
+		le.PutUint32(e[4:], count)
+		copy(e[8:], value)
+		return e
+	}
+	u16 := func(v uint16) []byte { return le.AppendUint16(nil, v) }
+	u32 := func(v uint32) []byte { return le.AppendUint32(nil, v) }
+
+	// IFD0 с 8 по 38, GPS IFD с 38 по 68, значение широты с 68
+	tiff = append(tiff, u16(2)...)
+	tiff = append(tiff, entry(0x0112, 3, 1, u16(orientation))...)
+	tiff = append(tiff, entry(0x8825, 4, 1, u32(38))...)
+	tiff = append(tiff, u32(0)...)
+	tiff = append(tiff, u16(2)...)
+	tiff = append(tiff, entry(1, 2, 2, []byte("N\x00"))...)
+	tiff = append(tiff, entry(2, 5, 3, u32(68))...)
+	tiff = append(tiff, u32(0)...)
+	tiff = append(tiff, testGPSLatitude...)
+	return append([]byte("Exif\x00\x00"), tiff...)
+}
+
+// testJPEG картинка с градиентом, EXIF вставляется сразу после SOI
+func testJPEG(t *testing.T, width, height int, exif []byte) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+	data := buf.Bytes()
+	if exif == nil {
+		return data
+	}
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	segment = append(segment, exif...)
+	return append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+}
+
+func testWorker() *jobs.Worker {
+	return &jobs.Worker{
+		DB:          testDB,
+		Blobs:       testBlobs,
+		Sizes:       []int{160, 320, 800},
+		MaxAttempts: 2,
+		Backoff:     time.Minute,
+	}
+}
+
+func TestMedia_Process(t *testing.T) {
+	// снято повернутым: хранится 400x200, показывается 200x400
+	data := testJPEG(t, 400, 200, testEXIF(6))
+	result, err := media.Process(data, []int{320, 160, 800, 160})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 200, result.Width)
+	assert.Equal(t, 400, result.Height)
+	assert.Len(t, result.Blurhash, 28)
+
+	// 800 больше исходника и не строится, повтор 160 пропускается
+	if assert.Len(t, result.Thumbnails, 2) {
+		small := result.Thumbnails[0]
+		assert.Equal(t, 160, small.Size)
+		assert.Equal(t, 80, small.Width)
+		assert.Equal(t, 160, small.Height)
+
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(small.Data))
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 80, cfg.Width)
+		assert.Equal(t, 160, cfg.Height)
+		assert.Equal(t, 320, result.Thumbnails[1].Size)
+	}
+
+	// координаты затерты на месте, остальное не тронуто
+	if assert.NotNil(t, result.Cleaned) {
+		assert.Len(t, result.Cleaned, len(data))
+		assert.True(t, bytes.Contains(data, testGPSLatitude))
+		assert.False(t, bytes.Contains(result.Cleaned, testGPSLatitude))
+		_, err := jpeg.Decode(bytes.NewReader(result.Cleaned))
+		assert.NoError(t, err)
+
+		again, err := media.Process(result.Cleaned, nil)
+		assert.NoError(t, err)
+		assert.Nil(t, again.Cleaned)
+		assert.Equal(t, 200, again.Width)
+	}
+
+	plain, err := media.Process(testJPEG(t, 100, 50, nil), []int{160})
+	assert.NoError(t, err)
+	assert.Nil(t, plain.Cleaned)
+	assert.Empty(t, plain.Thumbnails)
+	assert.Equal(t, 100, plain.Width)
+
+	_, err = media.Process([]byte("\x89PNG fake"), []int{160})
+	assert.ErrorIs(t, err, media.ErrInvalidImage)
+
+	assert.True(t, media.Supported("image/jpeg"))
+	assert.True(t, media.Supported("image/webp"))
+	assert.False(t, media.Supported("image/svg+xml"))
+	assert.False(t, media.Supported("text/plain"))
+}
+
+func (suite *HandlersTestSuite) thumbnail(attachmentID uint, size int, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", fmt.Sprintf("/attachments/%d/thumbnails/%d", attachmentID, size), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func (suite *HandlersTestSuite) TestAttachments_ImageProcessing() {
+	suite.requireDB()
+	t := suite.T()
+
+	chat := createTestChat(t, "Фото", suite.user.ID)
+	photo := testJPEG(t, 400, 300, testEXIF(1))
+	rr := suite.postMultipart(chat.ID, "", []testFile{
+		{"photo.jpg", "image/jpeg", string(photo)},
+		{"notes.txt", "text/plain", "no thumbnails"},
+	}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	if !assert.Len(t, message.Attachments, 2) {
+		return
+	}
+	// ответ обработку не ждет
+	picture, notes := message.Attachments[0], message.Attachments[1]
+	assert.Nil(t, picture.Blurhash)
+	assert.Empty(t, picture.Thumbnails)
+
+	var queued []models.AttachmentJob
+	testDB.Find(&queued)
+	if assert.Len(t, queued, 1) {
+		assert.Equal(t, picture.ID, queued[0].AttachmentID)
+		assert.Equal(t, models.JobPending, queued[0].Status)
+	}
+	rr = suite.thumbnail(picture.ID, 160, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	processed, err := testWorker().RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, processed)
+
+	page := suite.getHistory(chat.ID, "")
+	if !assert.Len(t, page.Messages, 1) || !assert.Len(t, page.Messages[0].Attachments, 2) {
+		return
+	}
+	processedImage := page.Messages[0].Attachments[0]
+	if assert.NotNil(t, processedImage.Width) && assert.NotNil(t, processedImage.Height) {
+		assert.Equal(t, 400, *processedImage.Width)
+		assert.Equal(t, 300, *processedImage.Height)
+	}
+	assert.NotEmpty(t, processedImage.Blurhash)
+	if assert.Len(t, processedImage.Thumbnails, 2) {
+		assert.Equal(t, 160, processedImage.Thumbnails[0].Size)
+		assert.Equal(t, 120, processedImage.Thumbnails[0].Height)
+		assert.Equal(t, 320, processedImage.Thumbnails[1].Size)
+	}
+	assert.Nil(t, page.Messages[0].Attachments[1].Blurhash)
+
+	rr = suite.thumbnail(picture.ID, 320, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, 320, cfg.Width)
+
+	rr = suite.thumbnail(picture.ID, 800, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = suite.thumbnail(notes.ID, 160, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// у исходника вырезан GPS, хеш пересчитан
+	rr = suite.download(picture.ID, "", suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, rr.Body.Bytes(), len(photo))
+	assert.False(t, bytes.Contains(rr.Body.Bytes(), testGPSLatitude))
+	sum := sha256.Sum256(rr.Body.Bytes())
+	assert.Equal(t, hex.EncodeToString(sum[:]), processedImage.SHA256)
+
+	// превью видят только участники
+	_, strangerToken := createTestUser(t, "stranger")
+	rr = suite.thumbnail(picture.ID, 160, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	var job models.AttachmentJob
+	testDB.First(&job)
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+
+	processed, err = testWorker().RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, processed)
+
+	// вместе с чатом удаляются и файлы превью
+	var keys []string
+	testDB.Model(&models.AttachmentThumbnail{}).Pluck("storage_key", &keys)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	for _, key := range keys {
+		_, err := testBlobs.Open(context.Background(), key)
+		assert.Error(t, err, key)
+	}
+}
+
+func (suite *HandlersTestSuite) TestAttachments_ProcessingRetries() {
+	suite.requireDB()
+	t := suite.T()
+
+	chat := createTestChat(t, "Повторы", suite.user.ID)
+	rr := suite.postMultipart(chat.ID, "", []testFile{
+		{"lost.jpg", "image/jpeg", string(testJPEG(t, 64, 64, nil))},
+		{"broken.png", "image/png", "\x89PNG fake"},
+	}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+
+	var lost models.Attachment
+	testDB.Where("filename = ?", "lost.jpg").First(&lost)
+	// файл пропал из хранилища: ошибка временная, задача откладывается
+	testBlobs.Delete(context.Background(), lost.StorageKey)
+
+	logs := &logBuffer{}
+	worker := testWorker()
+	worker.Logger = slog.New(slog.NewJSONHandler(logs, nil))
+	processed, err := worker.RunOnce(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, processed)
+	levels := map[string]bool{}
+	for _, entry := range logs.entries() {
+		assert.NotNil(t, entry["job_id"])
+		levels[entry["level"].(string)] = true
+	}
+	assert.Equal(t, map[string]bool{"WARN": true, "ERROR": true}, levels, "повтор и окончательный отказ")
+
+	var job models.AttachmentJob
+	testDB.Where("attachment_id = ?", lost.ID).First(&job)
+	assert.Equal(t, models.JobPending, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotEmpty(t, job.LastError)
+	assert.True(t, job.RunAt.After(time.Now().Add(30*time.Second)))
+
+	// битая картинка не лечится повтором
+	var broken models.AttachmentJob
+	testDB.Joins("JOIN attachments ON attachments.id = attachment_jobs.attachment_id").
+		Where("attachments.filename = ?", "broken.png").First(&broken)
+	assert.Equal(t, models.JobFailed, broken.Status)
+	assert.Equal(t, 1, broken.Attempts)
+
+	// до конца паузы задачу не берут
+	processed, _ = worker.RunOnce(context.Background())
+	assert.Zero(t, processed)
+
+	testDB.Model(&models.AttachmentJob{}).Where("id = ?", job.ID).Update("run_at", time.Now().Add(-time.Second))
+	processed, _ = worker.RunOnce(context.Background())
+	assert.Equal(t, 1, processed)
+
+	testDB.First(&job, job.ID)
+	assert.Equal(t, models.JobFailed, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+}
+
+func (suite *HandlersTestSuite) TestAttachments_WorkerStops() {
+	t := suite.T()
+
+	worker := testWorker()
+	worker.Interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("воркер не остановился после отмены контекста")
+	}
+}
+
+func (suite *HandlersTestSuite) TestAttachments_SweepExpired() {
+	suite.requireDB()
+	t := suite.T()
+	ctx := context.Background()
+
+	chat := createTestChat(t, "Файлы", suite.user.ID)
+	abandoned, abandonedURL := suite.reserveAttachment(chat.ID, "abandoned.txt", "never arrives", suite.token)
+	pending, _ := suite.reserveAttachment(chat.ID, "pending.txt", "later", suite.token)
+	uploaded, uploadedURL := suite.reserveAttachment(chat.ID, "uploaded.txt", "done", suite.token)
+	assert.Equal(t, http.StatusOK, suite.upload(uploadedURL, "done").Code)
+
+	// загрузка оборвалась на середине: ключ записан, файл недописан
+	partialKey := fmt.Sprintf("chats/%d/partial", chat.ID)
+	assert.NoError(t, testStore.BeginUpload(ctx, abandoned.ID, partialKey))
+	assert.NoError(t, testBlobs.Put(ctx, partialKey, bytes.NewReader([]byte("never")), 5, "text/plain"))
+
+	// у загруженного срок снят, так что попадает под удаление только просроченная резервация
+	var stored models.Attachment
+	testDB.First(&stored, uploaded.ID)
+	assert.Nil(t, stored.ExpiresAt)
+	testDB.Model(&models.Attachment{}).Where("id = ?", abandoned.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+	swept, err := testWorker().SweepExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, swept)
+
+	assert.Error(t, testDB.First(&models.Attachment{}, abandoned.ID).Error)
+	_, err = testBlobs.Open(ctx, partialKey)
+	assert.Error(t, err)
+	assert.NoError(t, testDB.First(&models.Attachment{}, pending.ID).Error)
+	assert.NoError(t, testDB.First(&models.Attachment{}, uploaded.ID).Error)
+	assert.Equal(t, http.StatusOK, suite.download(uploaded.ID, "", suite.token).Code)
+
+	// токен удаленной резервации больше ни к чему не ведет
+	assert.Equal(t, http.StatusNotFound, suite.upload(abandonedURL, "never arrives").Code)
+
+	swept, err = testWorker().SweepExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, swept)
+}
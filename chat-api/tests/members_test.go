@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+func (suite *HandlersTestSuite) TestCreateChat_CreatorIsOwner() {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", "/chats", map[string]string{"title": "Мой чат"}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+
+	member, err := testStore.Member(context.Background(), chat.ID, suite.user.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.RoleOwner, member.Role)
+	}
+}
+
+func (suite *HandlersTestSuite) TestChat_NonMemberForbidden() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Чужой чат", suite.user.ID)
+	_, strangerToken := createTestUser(t, "stranger")
+
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]string{"text": "Привет"}, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestDeleteChat_OnlyOwner() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Чат", suite.user.ID)
+	admin, adminToken := createTestUser(t, "admin")
+	addTestMember(t, chat.ID, admin.ID, models.RoleAdmin)
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, adminToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestMembers_AddListRemove() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Чат", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]interface{}{
+		"user_id": friend.ID,
+	}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]interface{}{
+		"user_id": friend.ID,
+	}, suite.token)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/members", chat.ID), nil, friendToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var members []models.ChatMember
+	err := json.Unmarshal(rr.Body.Bytes(), &members)
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, models.RoleOwner, members[0].Role)
+		assert.Equal(t, "tester", members[0].User.Username)
+		assert.Equal(t, models.RoleMember, members[1].Role)
+		assert.Equal(t, "friend", members[1].User.Username)
+	}
+
+	// обычный участник не может добавлять
+	other, _ := createTestUser(t, "other")
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]interface{}{
+		"user_id": other.ID,
+	}, friendToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// и может выйти сам
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, friend.ID), nil, friendToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, friendToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestMembers_RoleRules() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Чат", suite.user.ID)
+	admin, adminToken := createTestUser(t, "admin")
+	addTestMember(t, chat.ID, admin.ID, models.RoleAdmin)
+	other, _ := createTestUser(t, "other")
+
+	// админ не раздает админку
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]interface{}{
+		"user_id": other.ID,
+		"role":    models.RoleAdmin,
+	}, adminToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/members", chat.ID), map[string]interface{}{
+		"user_id": other.ID,
+		"role":    models.RoleOwner,
+	}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// владельца не удалить
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, suite.user.ID), nil, adminToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, admin.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
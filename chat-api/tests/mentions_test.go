@@ -0,0 +1,191 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/store"
+)
+
+type mentionsResponse struct {
+	Mentions []struct {
+		MessageID uint            `json:"message_id"`
+		ChatID    uint            `json:"chat_id"`
+		ChatTitle string          `json:"chat_title"`
+		Everyone  bool            `json:"everyone"`
+		ReadAt    *string         `json:"read_at"`
+		Message   *models.Message `json:"message"`
+	} `json:"mentions"`
+	UnreadCount int64 `json:"unread_count"`
+	NextCursor  *uint `json:"next_cursor"`
+}
+
+func (suite *HandlersTestSuite) getMentions(query, token string) mentionsResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", "/me/mentions"+query, nil, token)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response mentionsResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestMentions_Inbox() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Планерка", suite.user.ID)
+	alice, aliceToken := createTestUser(t, "alice")
+	bob, bobToken := createTestUser(t, "bob")
+	addTestMember(t, chat.ID, alice.ID, models.RoleMember)
+	addTestMember(t, chat.ID, bob.ID, models.RoleMember)
+
+	direct := suite.postMessage(chat.ID, "@alice. Глянь отчет", suite.token)
+	everyone := suite.postMessage(chat.ID, "Всем привет, @all и @alice", suite.token)
+	// почта, незнакомое имя и свое имя упоминаниями не считаются
+	suite.postMessage(chat.ID, "пишите на boss@alice.com, @nobody и @tester", suite.token)
+
+	inbox := suite.getMentions("", aliceToken)
+	assert.Equal(t, int64(2), inbox.UnreadCount)
+	if assert.Len(t, inbox.Mentions, 2) {
+		assert.Equal(t, everyone.ID, inbox.Mentions[0].MessageID)
+		// упомянута и по имени, это важнее @all
+		assert.False(t, inbox.Mentions[0].Everyone)
+		assert.Equal(t, direct.ID, inbox.Mentions[1].MessageID)
+		assert.Equal(t, "Планерка", inbox.Mentions[1].ChatTitle)
+		assert.Nil(t, inbox.Mentions[1].ReadAt)
+		if assert.NotNil(t, inbox.Mentions[1].Message) {
+			assert.Equal(t, "@alice. Глянь отчет", inbox.Mentions[1].Message.Text)
+		}
+	}
+
+	inbox = suite.getMentions("", bobToken)
+	if assert.Len(t, inbox.Mentions, 1) {
+		assert.True(t, inbox.Mentions[0].Everyone)
+	}
+	assert.Empty(t, suite.getMentions("", suite.token).Mentions)
+
+	// постранично
+	page := suite.getMentions("?limit=1", aliceToken)
+	assert.Len(t, page.Mentions, 1)
+	if assert.NotNil(t, page.NextCursor) {
+		page = suite.getMentions(fmt.Sprintf("?limit=1&before=%d", *page.NextCursor), aliceToken)
+		if assert.Len(t, page.Mentions, 1) {
+			assert.Equal(t, direct.ID, page.Mentions[0].MessageID)
+		}
+		assert.Nil(t, page.NextCursor)
+	}
+
+	rr := performAuthRequest(suite.router, "POST", "/me/mentions/read", map[string][]uint{"message_ids": {direct.ID}}, aliceToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	unread := suite.getMentions("?unread=true", aliceToken)
+	assert.Equal(t, int64(1), unread.UnreadCount)
+	if assert.Len(t, unread.Mentions, 1) {
+		assert.Equal(t, everyone.ID, unread.Mentions[0].MessageID)
+	}
+	assert.NotNil(t, suite.getMentions("", aliceToken).Mentions[1].ReadAt)
+
+	// чтение остальных не задевает
+	assert.Equal(t, int64(1), suite.getMentions("", bobToken).UnreadCount)
+
+	rr = performAuthRequest(suite.router, "POST", "/me/mentions/read", struct{}{}, bobToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Zero(t, suite.getMentions("", bobToken).UnreadCount)
+
+	// удаленное сообщение пропадает из входящих
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, everyone.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	inbox = suite.getMentions("", aliceToken)
+	assert.Len(t, inbox.Mentions, 1)
+	assert.Zero(t, inbox.UnreadCount)
+}
+
+func (suite *HandlersTestSuite) TestMentions_NonMembersRejected() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Закрытый", suite.user.ID)
+	createTestUser(t, "carol")
+	createTestUser(t, "dave")
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]string{
+		"text": "@carol и @dave, посмотрите",
+	}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "@carol, @dave")
+
+	lastID, err := testStore.LastMessageID(context.Background(), chat.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, lastID)
+}
+
+func (suite *HandlersTestSuite) TestMentions_AllLargeChat() {
+	t := suite.T()
+	ctx := context.Background()
+
+	// участников больше, чем упоминаний вставляется одним запросом
+	chat := createTestChat(t, "Большой", suite.user.ID)
+	members := make([]*models.User, 1100)
+	for i := range members {
+		members[i], _ = createTestUser(t, fmt.Sprintf("member%d", i))
+		addTestMember(t, chat.ID, members[i].ID, models.RoleMember)
+	}
+	_, lastToken := createTestUser(t, "latecomer")
+
+	message := suite.postMessage(chat.ID, "@all, и особенно @member7", suite.token)
+
+	mentioned := 0
+	for _, u := range members {
+		hits, err := testStore.Mentions(ctx, store.MentionQuery{UserID: u.ID, Limit: 1})
+		assert.NoError(t, err)
+		if len(hits) == 1 && hits[0].MessageID == message.ID {
+			mentioned++
+			// упомянутый по имени не помечается как упомянутый через @all
+			assert.Equal(t, u.ID != members[7].ID, hits[0].Everyone)
+		}
+	}
+	assert.Equal(t, len(members), mentioned)
+
+	// не участник и сам автор упоминаний не получают
+	assert.Empty(t, suite.getMentions("", lastToken).Mentions)
+	assert.Empty(t, suite.getMentions("", suite.token).Mentions)
+}
+
+func (suite *HandlersTestSuite) TestMentions_ReadWithChat() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Общий", suite.user.ID)
+	other := createTestChat(t, "Другой", suite.user.ID)
+	alice, aliceToken := createTestUser(t, "alice")
+	addTestMember(t, chat.ID, alice.ID, models.RoleMember)
+	addTestMember(t, other.ID, alice.ID, models.RoleMember)
+
+	root := suite.postMessage(chat.ID, "@alice вопрос", suite.token)
+	reply := suite.postReply(chat.ID, root.ID, "@alice уточнение в ветке")
+	suite.postMessage(other.ID, "@alice тут тоже", suite.token)
+
+	inbox := suite.getMentions(fmt.Sprintf("?chat_id=%d", chat.ID), aliceToken)
+	assert.Len(t, inbox.Mentions, 2)
+	assert.Equal(t, int64(3), inbox.UnreadCount)
+
+	// прочитанная лента закрывает упоминания в ней, но не в ветках и не в других чатах
+	suite.markRead(chat.ID, struct{}{}, aliceToken)
+	unread := suite.getMentions("?unread=true", aliceToken)
+	assert.Equal(t, int64(2), unread.UnreadCount)
+	if assert.Len(t, unread.Mentions, 2) {
+		assert.Equal(t, other.ID, unread.Mentions[0].ChatID)
+		assert.Equal(t, reply.ID, unread.Mentions[1].MessageID)
+	}
+
+	// из покинутого чата упоминания не видны
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", other.ID, alice.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, int64(1), suite.getMentions("", aliceToken).UnreadCount)
+
+	rr = performAuthRequest(suite.router, "GET", "/me/mentions?chat_id=abc", nil, aliceToken)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/handlers"
+	"chat-api/internal/metrics"
+	"chat-api/internal/middleware"
+	"chat-api/internal/models"
+)
+
+// metricsRouter маршруты как в main.go, метрики отдаются отдельным обработчиком
+func metricsRouter(m *metrics.Metrics) http.Handler {
+	h := newTestHandler()
+	h.Metrics = m
+	r := mux.NewRouter()
+	r.Use(middleware.Route)
+	r.Use(middleware.JSONContentType)
+	handlers.InitHandlers(r, h)
+	return middleware.RequestID(middleware.Logging(slog.Default())(middleware.Metrics(m)(r)))
+}
+
+func scrapeMetrics(m *metrics.Metrics) string {
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rr.Body)
+	return string(body)
+}
+
+func (suite *HandlersTestSuite) TestMetrics_Counters() {
+	t := suite.T()
+
+	sqlDB, err := testDB.DB()
+	if !assert.NoError(t, err) {
+		return
+	}
+	m := metrics.New(sqlDB)
+	router := metricsRouter(m)
+
+	rr := performAuthRequest(router, "POST", "/chats", map[string]string{"title": "Метрики"}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+	chatID := chat.ID
+	for i := 0; i < 2; i++ {
+		rr = performAuthRequest(router, "POST", fmt.Sprintf("/chats/%d/messages", chatID), map[string]string{"text": "привет"}, suite.token)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	}
+	rr = performAuthRequest(router, "GET", "/chats/999999", nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = performAuthRequest(router, "DELETE", fmt.Sprintf("/chats/%d", chatID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = performAuthRequest(router, "GET", "/nowhere/123", nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = performAuthRequest(router, "PATCH", "/chats", nil, suite.token)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	for _, method := range []string{"BREW", "PROPFIND"} {
+		rr = performAuthRequest(router, method, "/chats", nil, suite.token)
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	}
+
+	out := scrapeMetrics(m)
+	// ряды по шаблону маршрута, а не по пути
+	assert.Contains(t, out, `chat_api_http_requests_total{method="POST",route="/chats/{id}/messages",status="201"} 2`)
+	assert.Contains(t, out, `chat_api_http_requests_total{method="GET",route="/chats/{id}",status="404"} 1`)
+	assert.Contains(t, out, `chat_api_http_request_duration_seconds_count{method="POST",route="/chats"} 1`)
+	assert.NotContains(t, out, "/chats/999999")
+	// запросы мимо маршрутов в одном ряду, путь в метку не попадает
+	assert.Contains(t, out, `chat_api_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out, `chat_api_http_requests_total{method="PATCH",route="unmatched",status="405"} 1`)
+	// нестандартные методы сводятся в один ряд
+	assert.Contains(t, out, `chat_api_http_requests_total{method="other",route="unmatched",status="405"} 2`)
+	assert.NotContains(t, out, "BREW")
+	assert.NotContains(t, out, "/nowhere")
+	assert.Contains(t, out, "chat_api_messages_created_total 2")
+	assert.Contains(t, out, `chat_api_chats_created_total{type="group"} 1`)
+	assert.Contains(t, out, "chat_api_chats_deleted_total 1")
+	assert.Contains(t, out, `go_sql_open_connections{db_name="chat"}`)
+}
+
+func (suite *HandlersTestSuite) TestMetrics_Connections() {
+	t := suite.T()
+
+	m := metrics.New(nil)
+	server := httptest.NewServer(metricsRouter(m))
+	defer server.Close()
+	chat := createTestChat(t, "Соединения", suite.user.ID)
+
+	assert.Contains(t, scrapeMetrics(m), `chat_api_realtime_connections{transport="websocket"} 0`)
+
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Eventually(t, func() bool {
+		return strings.Contains(scrapeMetrics(m), `chat_api_realtime_connections{transport="websocket"} 1`)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	conn.Close()
+	assert.Eventually(t, func() bool {
+		return strings.Contains(scrapeMetrics(m), `chat_api_realtime_connections{transport="websocket"} 0`)
+	}, 2*time.Second, 10*time.Millisecond)
+}
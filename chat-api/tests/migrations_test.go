@@ -0,0 +1,55 @@
+package tests
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/database"
+	"chat-api/migrations"
+)
+
+func TestMigrations_Embedded(t *testing.T) {
+	goose.SetBaseFS(migrations.FS)
+	defer goose.SetBaseFS(nil)
+
+	// номера идут подряд с первого, у каждой миграции есть обе половины
+	collected, err := goose.CollectMigrations(".", 0, goose.MaxVersion)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotEmpty(t, collected)
+	for i, m := range collected {
+		assert.Equal(t, int64(i+1), m.Version, m.Source)
+
+		data, err := fs.ReadFile(migrations.FS, filepath.Base(m.Source))
+		if assert.NoError(t, err) {
+			assert.Contains(t, string(data), "-- +goose Up", m.Source)
+			assert.Contains(t, string(data), "-- +goose Down", m.Source)
+		}
+	}
+
+	// в бинарник зашиты все файлы из папки
+	onDisk, _ := filepath.Glob("../migrations/*.sql")
+	assert.Len(t, collected, len(onDisk))
+}
+
+func TestMigrations_Create(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "001_init.sql"), []byte("-- +goose Up\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "009_later.sql"), []byte("-- +goose Up\n"), 0644)
+
+	path, err := database.CreateMigration(dir, "add_widgets")
+	assert.NoError(t, err)
+	assert.Equal(t, "010_add_widgets.sql", filepath.Base(path))
+	data, _ := os.ReadFile(path)
+	assert.True(t, strings.HasPrefix(string(data), "-- +goose Up"))
+
+	_, err = database.CreateMigration(dir, "Add Widgets")
+	assert.Error(t, err)
+}
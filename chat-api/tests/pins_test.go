@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/realtime"
+)
+
+func pinPath(chatID, messageID uint) string {
+	return fmt.Sprintf("/chats/%d/pins/%d", chatID, messageID)
+}
+
+func (suite *HandlersTestSuite) TestPins_PinAndList() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Объявления", suite.user.ID)
+	first := suite.postMessage(chat.ID, "Правила чата", suite.token)
+	second := suite.postMessage(chat.ID, "Расписание", suite.token)
+
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rr := performAuthRequest(suite.router, "POST", pinPath(chat.ID, first.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	var pin models.MessagePin
+	json.Unmarshal(rr.Body.Bytes(), &pin)
+	assert.Equal(t, first.ID, pin.MessageID)
+	if assert.NotNil(t, pin.PinnedBy) {
+		assert.Equal(t, suite.user.ID, *pin.PinnedBy)
+	}
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessagePinned, event.Type)
+	assert.Equal(t, float64(first.ID), event.Data["message_id"])
+
+	// повторное закрепление ничего не меняет
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, first.ID), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, second.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	event, _ = readSocketEvent(conn)
+	assert.Equal(t, float64(second.ID), event.Data["message_id"])
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/pins", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var pins []models.MessagePin
+	json.Unmarshal(rr.Body.Bytes(), &pins)
+	if assert.Len(t, pins, 2) {
+		assert.Equal(t, second.ID, pins[0].MessageID)
+		if assert.NotNil(t, pins[1].Message) {
+			assert.Equal(t, "Правила чата", pins[1].Message.Text)
+		}
+	}
+
+	var chatResponse struct {
+		PinnedMessageIDs []uint `json:"pinned_message_ids"`
+	}
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	json.Unmarshal(rr.Body.Bytes(), &chatResponse)
+	assert.Equal(t, []uint{second.ID, first.ID}, chatResponse.PinnedMessageIDs)
+
+	rr = performAuthRequest(suite.router, "DELETE", pinPath(chat.ID, second.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	event, _ = readSocketEvent(conn)
+	assert.Equal(t, realtime.EventMessageUnpinned, event.Type)
+	rr = performAuthRequest(suite.router, "DELETE", pinPath(chat.ID, second.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	// удаленное сообщение открепляется
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, first.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	json.Unmarshal(rr.Body.Bytes(), &chatResponse)
+	assert.Empty(t, chatResponse.PinnedMessageIDs)
+}
+
+func (suite *HandlersTestSuite) TestPins_LimitAndRoles() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Команда", suite.user.ID)
+	admin, adminToken := createTestUser(t, "admin")
+	member, memberToken := createTestUser(t, "member")
+	_, strangerToken := createTestUser(t, "stranger")
+	addTestMember(t, chat.ID, admin.ID, models.RoleAdmin)
+	addTestMember(t, chat.ID, member.ID, models.RoleMember)
+
+	var messages []models.Message
+	for i := 0; i <= testPinLimit; i++ {
+		messages = append(messages, suite.postMessage(chat.ID, fmt.Sprintf("Сообщение %d", i), suite.token))
+	}
+
+	rr := performAuthRequest(suite.router, "POST", pinPath(chat.ID, messages[0].ID), nil, memberToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, messages[0].ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	for _, m := range messages[:testPinLimit] {
+		rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, m.ID), nil, adminToken)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	}
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, messages[testPinLimit].ID), nil, adminToken)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	// уже закрепленное на лимит не натыкается
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, messages[0].ID), nil, adminToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = performAuthRequest(suite.router, "DELETE", pinPath(chat.ID, messages[0].ID), nil, memberToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// список видят все участники
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/pins", chat.ID), nil, memberToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/pins", chat.ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, 999999), nil, adminToken)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestPins_DirectChat() {
+	t := suite.T()
+
+	alice, aliceToken := createTestUser(t, "alice")
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/dm/%d", alice.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var chat models.Chat
+	json.Unmarshal(rr.Body.Bytes(), &chat)
+	message := suite.postMessage(chat.ID, "Адрес встречи", suite.token)
+
+	// ролей в личном чате нет, закрепляют и открепляют оба собеседника
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, message.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusCreated, rr.Code, rr.Body.String())
+	rr = performAuthRequest(suite.router, "DELETE", pinPath(chat.ID, message.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	rr = performAuthRequest(suite.router, "POST", pinPath(chat.ID, message.ID), nil, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	rr = performAuthRequest(suite.router, "DELETE", pinPath(chat.ID, message.ID), nil, aliceToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+}
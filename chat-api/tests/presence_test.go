@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/presence"
+	"chat-api/internal/realtime"
+)
+
+type presenceResponse struct {
+	Online []uint `json:"online"`
+	Typing []uint `json:"typing"`
+}
+
+func (suite *HandlersTestSuite) getPresence(chatID uint) presenceResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/presence", chatID), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response presenceResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestPresence_TypingExpires() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Болталка", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleMember)
+
+	assert.Equal(t, presenceResponse{Online: []uint{}, Typing: []uint{}}, suite.getPresence(chat.ID))
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), struct{}{}, friendToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, presenceResponse{Online: []uint{friend.ID}, Typing: []uint{friend.ID}}, suite.getPresence(chat.ID))
+
+	// отметка пропадает сама, онлайн живет дольше
+	time.Sleep(testTypingTTL + 50*time.Millisecond)
+	assert.Equal(t, presenceResponse{Online: []uint{friend.ID}, Typing: []uint{}}, suite.getPresence(chat.ID))
+
+	// отправленное сообщение и явный typing=false снимают отметку сразу
+	performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), struct{}{}, friendToken)
+	suite.postMessage(chat.ID, "Готово", friendToken)
+	assert.Empty(t, suite.getPresence(chat.ID).Typing)
+
+	performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), struct{}{}, suite.token)
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), map[string]bool{"typing": false}, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, suite.getPresence(chat.ID).Typing)
+
+	_, strangerToken := createTestUser(t, "stranger")
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), struct{}{}, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/presence", chat.ID), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestPresence_SocketMarksOnline() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Болталка", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleMember)
+
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assert.Equal(t, []uint{suite.user.ID}, suite.getPresence(chat.ID).Online)
+
+	performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/typing", chat.ID), struct{}{}, friendToken)
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventTyping, event.Type)
+	assert.Equal(t, float64(friend.ID), event.Data["user_id"])
+	assert.Equal(t, true, event.Data["typing"])
+}
+
+// одинаковые проверки для обоих хранилищ, redis подменяется miniredis
+func (suite *HandlersTestSuite) TestPresence_Stores() {
+	t := suite.T()
+
+	mr := miniredis.RunT(t)
+	stores := map[string]presence.Store{
+		"memory": presence.NewMemoryStore(),
+		"redis":  presence.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()})),
+	}
+
+	for name, store := range stores {
+		ctx := context.Background()
+		ttl := 100 * time.Millisecond
+
+		assert.NoError(t, store.Touch(ctx, presence.Typing, 1, 3, ttl), name)
+		assert.NoError(t, store.Touch(ctx, presence.Typing, 1, 2, time.Minute), name)
+		assert.NoError(t, store.Touch(ctx, presence.Online, 1, 5, time.Minute), name)
+		assert.NoError(t, store.Touch(ctx, presence.Typing, 2, 4, time.Minute), name)
+
+		users, err := store.Users(ctx, presence.Typing, 1)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []uint{2, 3}, users, name)
+
+		time.Sleep(ttl + 50*time.Millisecond)
+		users, err = store.Users(ctx, presence.Typing, 1)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []uint{2}, users, name)
+
+		assert.NoError(t, store.Clear(ctx, presence.Typing, 1, 2), name)
+		users, err = store.Users(ctx, presence.Typing, 1)
+		assert.NoError(t, err, name)
+		assert.Equal(t, []uint{}, users, name)
+
+		// чаты и виды отметок не смешиваются
+		users, _ = store.Users(ctx, presence.Online, 1)
+		assert.Equal(t, []uint{5}, users, name)
+		users, _ = store.Users(ctx, presence.Typing, 2)
+		assert.Equal(t, []uint{4}, users, name)
+	}
+}
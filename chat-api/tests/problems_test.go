@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/problem"
+)
+
+func decodeProblem(rr *httptest.ResponseRecorder) problem.Problem {
+	var p problem.Problem
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	return p
+}
+
+func (suite *HandlersTestSuite) TestProblems_Validation() {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", "/chats", map[string]string{"title": "   "}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"))
+
+	p := decodeProblem(rr)
+	assert.Equal(t, problem.ValidationFailed, p.Code)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "Bad Request", p.Title)
+	assert.Equal(t, "/chats", p.Instance)
+	if assert.Len(t, p.Errors, 1) {
+		assert.Equal(t, "title", p.Errors[0].Field)
+		assert.Equal(t, problem.FieldLength, p.Errors[0].Code)
+	}
+	// тот же ид, что и в заголовке ответа
+	assert.NotEmpty(t, p.RequestID)
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), p.RequestID)
+
+	rr = performAuthRequest(suite.router, "POST", "/auth/register", map[string]string{"username": "ab", "password": "12345678"}, "")
+	p = decodeProblem(rr)
+	if assert.Len(t, p.Errors, 1) {
+		assert.Equal(t, "username", p.Errors[0].Field)
+	}
+}
+
+func (suite *HandlersTestSuite) TestProblems_Codes() {
+	t := suite.T()
+
+	chat := createTestChat(suite.T(), "Коды", suite.user.ID)
+	_, strangerToken := createTestUser(t, "stranger")
+
+	cases := []struct {
+		method, path, token string
+		status              int
+		code                string
+	}{
+		{"GET", "/chats/999999", suite.token, http.StatusNotFound, problem.ChatNotFound},
+		{"GET", "/chats/abc", suite.token, http.StatusBadRequest, problem.InvalidID},
+		{"GET", fmt.Sprintf("/chats/%d", chat.ID), strangerToken, http.StatusForbidden, problem.NotMember},
+		{"GET", fmt.Sprintf("/chats/%d", chat.ID), "", http.StatusUnauthorized, problem.Unauthorized},
+		{"GET", fmt.Sprintf("/chats/%d?before=1&after=2", chat.ID), suite.token, http.StatusBadRequest, problem.InvalidCursor},
+		{"GET", "/nowhere", suite.token, http.StatusNotFound, problem.RouteNotFound},
+		{"PATCH", "/chats", suite.token, http.StatusMethodNotAllowed, problem.MethodNotAllowed},
+	}
+	for _, c := range cases {
+		rr := performAuthRequest(suite.router, c.method, c.path, nil, c.token)
+		assert.Equal(t, c.status, rr.Code, c.path)
+		assert.Equal(t, problem.ContentType, rr.Header().Get("Content-Type"), c.path)
+		p := decodeProblem(rr)
+		assert.Equal(t, c.code, p.Code, c.path)
+		// ид запроса есть и у ответов мимо маршрутов
+		assert.NotEmpty(t, rr.Header().Get("X-Request-ID"), c.path)
+		assert.Equal(t, rr.Header().Get("X-Request-ID"), p.RequestID, c.path)
+	}
+
+	// ответ в ветку на несуществующее сообщение
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]interface{}{
+		"text": "ответ", "parent_id": 999999,
+	}, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, problem.ParentNotFound, decodeProblem(rr).Code)
+}
+
+func (suite *HandlersTestSuite) TestProblems_RequestID() {
+	t := suite.T()
+
+	req := httptest.NewRequest("GET", "/chats/999999", nil)
+	req.Header.Set("Authorization", "Bearer "+suite.token)
+	req.Header.Set("X-Request-ID", "proxy-42")
+	rr := httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	assert.Equal(t, "proxy-42", rr.Header().Get("X-Request-ID"))
+	assert.Equal(t, "proxy-42", decodeProblem(rr).RequestID)
+
+	// мусорный ид от клиента заменяется своим
+	req = httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("X-Request-ID", "bad id\n"+strings.Repeat("x", 200))
+	rr = httptest.NewRecorder()
+	suite.router.ServeHTTP(rr, req)
+	assert.Len(t, rr.Header().Get("X-Request-ID"), 32)
+}
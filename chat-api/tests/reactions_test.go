@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+func reactionPath(chatID, messageID uint, reaction string) string {
+	return fmt.Sprintf("/chats/%d/messages/%d/reactions/%s", chatID, messageID, url.PathEscape(reaction))
+}
+
+func (suite *HandlersTestSuite) TestReactions_ValidatesEmoji() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Реакции", suite.user.ID)
+	message := suite.postMessage(chat.ID, "Смотрите", suite.token)
+
+	valid := []string{
+		"👍",
+		"❤️",
+		"🇷🇺",      // флаг
+		"👍🏽",      // тон кожи
+		"👩‍💻",     // ZWJ
+		"👨‍👩‍👧‍👦", // семья
+		"1️⃣",     // keycap
+		"🏴󠁧󠁢󠁳󠁣󠁴󠁿", // флаг Шотландии
+		":party_parrot:",
+	}
+	for _, reaction := range valid {
+		rr := performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, reaction), nil, suite.token)
+		assert.Equal(t, http.StatusOK, rr.Code, reaction)
+	}
+
+	invalid := []string{"a", "👍👍", "🇷", "ok👍", "1", ":unknown:", "👍‍"}
+	for _, reaction := range invalid {
+		rr := performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, reaction), nil, suite.token)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, reaction)
+	}
+}
+
+func (suite *HandlersTestSuite) TestReactions_CountsInHistory() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Реакции", suite.user.ID)
+	other, otherToken := createTestUser(t, "other")
+	addTestMember(t, chat.ID, other.ID, models.RoleMember)
+	message := suite.postMessage(chat.ID, "Смотрите", suite.token)
+
+	rr := performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, "👍"), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	// повторная реакция ничего не меняет
+	rr = performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, "👍"), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var reactions []models.ReactionCount
+	json.Unmarshal(rr.Body.Bytes(), &reactions)
+	assert.Equal(t, []models.ReactionCount{{Emoji: "👍", Count: 1, Me: true}}, reactions)
+
+	performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, "👍"), nil, otherToken)
+	performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, "🔥"), nil, otherToken)
+
+	page := suite.getHistory(chat.ID, "")
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, []models.ReactionCount{
+			{Emoji: "👍", Count: 2, Me: true},
+			{Emoji: "🔥", Count: 1, Me: false},
+		}, page.Messages[0].Reactions)
+	}
+
+	rr = performAuthRequest(suite.router, "DELETE", reactionPath(chat.ID, message.ID, "👍"), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	page = suite.getHistory(chat.ID, "")
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, []models.ReactionCount{
+			{Emoji: "👍", Count: 1, Me: false},
+			{Emoji: "🔥", Count: 1, Me: false},
+		}, page.Messages[0].Reactions)
+	}
+}
+
+func (suite *HandlersTestSuite) TestReactions_RequireMembership() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Реакции", suite.user.ID)
+	message := suite.postMessage(chat.ID, "Смотрите", suite.token)
+	_, strangerToken := createTestUser(t, "stranger")
+
+	rr := performAuthRequest(suite.router, "PUT", reactionPath(chat.ID, message.ID, "👍"), nil, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/realtime"
+)
+
+type readResponse struct {
+	LastReadMessageID *uint `json:"last_read_message_id"`
+	UnreadCount       int64 `json:"unread_count"`
+	FirstUnreadID     *uint `json:"first_unread_id"`
+}
+
+func (suite *HandlersTestSuite) markRead(chatID uint, body interface{}, token string) readResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/read", chatID), body, token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response readResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestReads_UnreadCounters() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Новости", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleMember)
+
+	first := suite.postMessage(chat.ID, "Первое", friendToken)
+	second := suite.postMessage(chat.ID, "Второе", friendToken)
+	suite.postReply(chat.ID, second.ID, "Свой ответ не считается")
+	third := suite.postMessage(chat.ID, "Третье", friendToken)
+	suite.postMessage(chat.ID, "Свое сообщение не считается", suite.token)
+
+	page := suite.getHistory(chat.ID, "")
+	assert.Nil(t, page.LastReadMessageID)
+	assert.Equal(t, int64(3), page.UnreadCount)
+	assert.Equal(t, &first.ID, page.FirstUnreadID)
+
+	read := suite.markRead(chat.ID, map[string]uint{"message_id": first.ID}, suite.token)
+	assert.Equal(t, &first.ID, read.LastReadMessageID)
+	assert.Equal(t, int64(2), read.UnreadCount)
+	assert.Equal(t, &second.ID, read.FirstUnreadID)
+
+	// позиция не откатывается назад
+	suite.markRead(chat.ID, map[string]uint{"message_id": second.ID}, suite.token)
+	read = suite.markRead(chat.ID, map[string]uint{"message_id": first.ID}, suite.token)
+	assert.Equal(t, &second.ID, read.LastReadMessageID)
+	assert.Equal(t, int64(1), read.UnreadCount)
+	assert.Equal(t, &third.ID, read.FirstUnreadID)
+
+	chats := suite.listChats("")
+	if assert.Len(t, chats.Chats, 1) {
+		assert.Equal(t, int64(1), chats.Chats[0].UnreadCount)
+		assert.Equal(t, &third.ID, chats.Chats[0].FirstUnreadID)
+	}
+
+	// удаленные сообщения не висят в непрочитанных
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, third.ID), nil, friendToken)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	page = suite.getHistory(chat.ID, "")
+	assert.Equal(t, int64(0), page.UnreadCount)
+	assert.Nil(t, page.FirstUnreadID)
+}
+
+func (suite *HandlersTestSuite) TestReads_MarkAllRead() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Новости", suite.user.ID)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleMember)
+	suite.postMessage(chat.ID, "Первое", friendToken)
+	last := suite.postMessage(chat.ID, "Второе", friendToken)
+
+	// без тела читается весь чат
+	read := suite.markRead(chat.ID, struct{}{}, suite.token)
+	assert.Equal(t, &last.ID, read.LastReadMessageID)
+	assert.Equal(t, int64(0), read.UnreadCount)
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/read", chat.ID), map[string]uint{"message_id": 999}, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	_, strangerToken := createTestUser(t, "stranger")
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/read", chat.ID), struct{}{}, strangerToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestReads_BroadcastPosition() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Новости", suite.user.ID)
+	message := suite.postMessage(chat.ID, "Первое", suite.token)
+
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	suite.markRead(chat.ID, struct{}{}, suite.token)
+	// повторное чтение ничего не меняет и не рассылается
+	suite.markRead(chat.ID, struct{}{}, suite.token)
+	suite.postMessage(chat.ID, "Второе", suite.token)
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventReadUpdated, event.Type)
+	assert.Equal(t, float64(suite.user.ID), event.Data["user_id"])
+	assert.Equal(t, float64(message.ID), event.Data["last_read_message_id"])
+
+	event, err = readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessageCreated, event.Type)
+}
+
+func (suite *HandlersTestSuite) TestReads_StoreFailure() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Сбой", suite.user.ID)
+	message := createTestMessage(t, chat.ID, "Привет")
+
+	// сбой хранилища не выдается за несуществующее сообщение
+	h := newTestHandler()
+	h.Messages = brokenStore{MessageStore: testStore}
+	rr := performAuthRequest(createRouterWith(h), "POST", fmt.Sprintf("/chats/%d/read", chat.ID), map[string]uint{"message_id": message.ID}, suite.token)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+func (suite *HandlersTestSuite) postMessage(chatID uint, text, token string) models.Message {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chatID), map[string]string{"text": text}, token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	return message
+}
+
+func (suite *HandlersTestSuite) TestEditMessage_KeepsRevisions() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Правки", suite.user.ID)
+	message := suite.postMessage(chat.ID, "Превед", suite.token)
+	path := fmt.Sprintf("/chats/%d/messages/%d", chat.ID, message.ID)
+
+	rr := performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": "Привет"}, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var edited models.Message
+	json.Unmarshal(rr.Body.Bytes(), &edited)
+	assert.Equal(t, "Привет", edited.Text)
+	assert.NotNil(t, edited.EditedAt)
+
+	rr = performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": "Привет всем"}, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// тот же текст ревизию не добавляет
+	rr = performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": " Привет всем "}, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", path+"/revisions", nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var revisions []models.MessageRevision
+	err := json.Unmarshal(rr.Body.Bytes(), &revisions)
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, "Превед", revisions[0].Text)
+		assert.Equal(t, "Привет", revisions[1].Text)
+	}
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Contains(t, rr.Body.String(), "Привет всем")
+}
+
+func (suite *HandlersTestSuite) TestEditMessage_OnlyAuthor() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Правки", suite.user.ID)
+	message := suite.postMessage(chat.ID, "Мое сообщение", suite.token)
+	friend, friendToken := createTestUser(t, "friend")
+	addTestMember(t, chat.ID, friend.ID, models.RoleAdmin)
+
+	path := fmt.Sprintf("/chats/%d/messages/%d", chat.ID, message.ID)
+	rr := performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": "Чужая правка"}, friendToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// проверка длины та же что при создании
+	rr = performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": strings.Repeat("a", 5001)}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = performAuthRequest(suite.router, "PATCH", path, map[string]string{"text": "   "}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	other := createTestChat(t, "Другой", suite.user.ID)
+	rr = performAuthRequest(suite.router, "PATCH", fmt.Sprintf("/chats/%d/messages/%d", other.ID, message.ID), map[string]string{"text": "Не тот чат"}, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/problem"
+)
+
+type searchResponse struct {
+	Results []struct {
+		Message   models.Message `json:"message"`
+		ChatTitle string         `json:"chat_title"`
+		Rank      float64        `json:"rank"`
+		Snippet   string         `json:"snippet"`
+	} `json:"results"`
+	NextOffset *int `json:"next_offset"`
+}
+
+func (suite *HandlersTestSuite) search(params url.Values, token string) searchResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", "/search?"+params.Encode(), nil, token)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var response searchResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestSearch_RanksAndHighlights() {
+	t := suite.T()
+
+	work := createTestChat(t, "Работа", suite.user.ID)
+	home := createTestChat(t, "Дом", suite.user.ID)
+	once := suite.postMessage(work.ID, "Созвон по релизу завтра", suite.token)
+	twice := suite.postMessage(home.ID, "Релиз релиз, где наш релиз?", suite.token)
+	suite.postMessage(home.ID, "Купить хлеб", suite.token)
+
+	response := suite.search(url.Values{"q": {"релиз"}}, suite.token)
+	if assert.Len(t, response.Results, 2) {
+		// частое совпадение выше
+		assert.Equal(t, twice.ID, response.Results[0].Message.ID)
+		assert.Equal(t, "Дом", response.Results[0].ChatTitle)
+		assert.Equal(t, once.ID, response.Results[1].Message.ID)
+		assert.Greater(t, response.Results[0].Rank, response.Results[1].Rank)
+		assert.Contains(t, response.Results[1].Snippet, "<mark>релизу</mark>")
+	}
+	assert.Nil(t, response.NextOffset)
+
+	// спецсимволы ищутся как текст, а не ломают запрос
+	response = suite.search(url.Values{"q": {`"релиз" OR -*`}}, suite.token)
+	assert.Empty(t, response.Results)
+}
+
+func (suite *HandlersTestSuite) TestSearch_SnippetEscapesHTML() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Работа", suite.user.ID)
+	suite.postMessage(chat.ID, `<img src=x onerror="alert(1)"> релиз & <b>жирный</b>`, suite.token)
+
+	response := suite.search(url.Values{"q": {"релиз"}}, suite.token)
+	if assert.Len(t, response.Results, 1) {
+		snippet := response.Results[0].Snippet
+		// разметка из текста экранирована, настоящие теги только у подсветки
+		assert.Contains(t, snippet, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;")
+		assert.Contains(t, snippet, "<mark>релиз</mark> &amp; &lt;b&gt;")
+		assert.NotContains(t, snippet, "<img")
+		assert.NotContains(t, snippet, "<b>")
+	}
+}
+
+func (suite *HandlersTestSuite) TestSearch_Filters() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Работа", suite.user.ID)
+	other := createTestChat(t, "Другой", suite.user.ID)
+	colleague, colleagueToken := createTestUser(t, "colleague")
+	addTestMember(t, chat.ID, colleague.ID, models.RoleMember)
+
+	mine := suite.postMessage(chat.ID, "Отчет готов", suite.token)
+	theirs := suite.postMessage(chat.ID, "Отчет проверю", colleagueToken)
+	elsewhere := suite.postMessage(other.ID, "Отчет в другом чате", suite.token)
+
+	response := suite.search(url.Values{"q": {"отчет"}, "chat_id": {fmt.Sprint(chat.ID)}}, suite.token)
+	assert.ElementsMatch(t, []uint{mine.ID, theirs.ID}, searchIDs(response))
+
+	response = suite.search(url.Values{"q": {"отчет"}, "author_id": {fmt.Sprint(colleague.ID)}}, suite.token)
+	assert.Equal(t, []uint{theirs.ID}, searchIDs(response))
+
+	// коллега не участник второго чата и не видит его сообщений
+	response = suite.search(url.Values{"q": {"отчет"}}, colleagueToken)
+	assert.ElementsMatch(t, []uint{mine.ID, theirs.ID}, searchIDs(response))
+
+	old, err := testStore.Message(context.Background(), other.ID, elsewhere.ID, false)
+	if !assert.NoError(t, err) {
+		return
+	}
+	old.CreatedAt = time.Now().Add(-48 * time.Hour)
+	saveTestMessage(t, old)
+	response = suite.search(url.Values{
+		"q":    {"отчет"},
+		"from": {time.Now().Add(-24 * time.Hour).Format(time.RFC3339)},
+	}, suite.token)
+	assert.ElementsMatch(t, []uint{mine.ID, theirs.ID}, searchIDs(response))
+
+	response = suite.search(url.Values{"q": {"отчет"}, "limit": {"2"}}, suite.token)
+	assert.Len(t, response.Results, 2)
+	if assert.NotNil(t, response.NextOffset) {
+		response = suite.search(url.Values{"q": {"отчет"}, "limit": {"2"}, "offset": {fmt.Sprint(*response.NextOffset)}}, suite.token)
+		assert.Len(t, response.Results, 1)
+	}
+
+	rr := performAuthRequest(suite.router, "GET", "/search?q=%D0%BE%D1%82%D1%87%D0%B5%D1%82&from=yesterday", nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = performAuthRequest(suite.router, "GET", "/search?q=+", nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	// отрицательный ид не превращается в огромный
+	for _, filter := range []string{"chat_id=-1", "author_id=-1", "chat_id=0"} {
+		rr = performAuthRequest(suite.router, "GET", "/search?q=%D0%BE%D1%82%D1%87%D0%B5%D1%82&"+filter, nil, suite.token)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, filter)
+		assert.Contains(t, rr.Body.String(), problem.InvalidID, filter)
+	}
+}
+
+func (suite *HandlersTestSuite) TestSearch_SkipsEditedAndDeleted() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Работа", suite.user.ID)
+	edited := suite.postMessage(chat.ID, "Черновик", suite.token)
+	deleted := suite.postMessage(chat.ID, "Секрет", suite.token)
+
+	rr := performAuthRequest(suite.router, "PATCH", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, edited.ID),
+		map[string]string{"text": "Чистовик"}, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d", chat.ID, deleted.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	assert.Empty(t, suite.search(url.Values{"q": {"черновик"}}, suite.token).Results)
+	assert.Equal(t, []uint{edited.ID}, searchIDs(suite.search(url.Values{"q": {"чистовик"}}, suite.token)))
+	assert.Empty(t, suite.search(url.Values{"q": {"секрет"}}, suite.token).Results)
+}
+
+func searchIDs(response searchResponse) []uint {
+	ids := make([]uint, len(response.Results))
+	for i, result := range response.Results {
+		ids[i] = result.Message.ID
+	}
+	return ids
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+	"chat-api/internal/realtime"
+)
+
+type socketEvent struct {
+	Type   string                 `json:"type"`
+	ChatID uint                   `json:"chat_id"`
+	Data   map[string]interface{} `json:"data"`
+}
+
+func dialChatSocket(server *httptest.Server, chatID uint, token string) (*websocket.Conn, *http.Response, error) {
+	url := fmt.Sprintf("ws%s/chats/%d/ws?access_token=%s", strings.TrimPrefix(server.URL, "http"), chatID, token)
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func readSocketEvent(conn *websocket.Conn) (socketEvent, error) {
+	var event socketEvent
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	err := conn.ReadJSON(&event)
+	return event, err
+}
+
+func (suite *HandlersTestSuite) TestChatSocket_ReceivesNewMessages() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Живой чат", suite.user.ID)
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]string{"text": "Через HTTP"}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessageCreated, event.Type)
+	assert.Equal(t, chat.ID, event.ChatID)
+	assert.Equal(t, "Через HTTP", event.Data["text"])
+}
+
+func (suite *HandlersTestSuite) TestChatSocket_SendMessage() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Живой чат", suite.user.ID)
+	conn, _, err := dialChatSocket(server, chat.ID, suite.token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	err = conn.WriteJSON(map[string]string{"type": "message.create", "text": "  Через сокет  "})
+	assert.NoError(t, err)
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMessageCreated, event.Type)
+	assert.Equal(t, "Через сокет", event.Data["text"])
+	assert.Equal(t, float64(suite.user.ID), event.Data["author_id"])
+
+	page := suite.getHistory(chat.ID, "")
+	if assert.Len(t, page.Messages, 1) {
+		assert.Equal(t, "Через сокет", page.Messages[0].Text)
+	}
+
+	err = conn.WriteJSON(map[string]string{"type": "message.create", "text": "   "})
+	assert.NoError(t, err)
+
+	event, err = readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventError, event.Type)
+}
+
+func (suite *HandlersTestSuite) TestChatSocket_RequiresMembership() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Живой чат", suite.user.ID)
+	_, strangerToken := createTestUser(t, "stranger")
+
+	_, resp, err := dialChatSocket(server, chat.ID, strangerToken)
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	}
+
+	_, resp, err = dialChatSocket(server, chat.ID, "")
+	assert.Error(t, err)
+	if assert.NotNil(t, resp) {
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func (suite *HandlersTestSuite) TestChatSocket_ClosedOnRemoval() {
+	t := suite.T()
+
+	server := httptest.NewServer(suite.router)
+	defer server.Close()
+
+	chat := createTestChat(t, "Живой чат", suite.user.ID)
+	member, memberToken := createTestUser(t, "member")
+	addTestMember(t, chat.ID, member.ID, models.RoleMember)
+
+	conn, _, err := dialChatSocket(server, chat.ID, memberToken)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/members/%d", chat.ID, member.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	event, err := readSocketEvent(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, realtime.EventMemberRemoved, event.Type)
+	assert.Equal(t, float64(member.ID), event.Data["user_id"])
+
+	// после исключения сервер закрывает соединение, новых сообщений бывший участник не видит
+	performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]string{"text": "Уже без тебя"}, suite.token)
+	_, err = readSocketEvent(conn)
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), "ожидали закрытие, получили %v", err)
+}
+
+func (suite *HandlersTestSuite) TestHub_DropsSlowSubscriber() {
+	t := suite.T()
+
+	hub := realtime.NewHub()
+	slow := hub.Subscribe(1, 2)
+	fast := hub.Subscribe(1, 10)
+	other := hub.Subscribe(2, 1)
+
+	for i := 0; i < 3; i++ {
+		hub.Publish(realtime.Event{Type: realtime.EventMessageCreated, ChatID: 1})
+	}
+
+	// медленный получил два события и был отключен
+	<-slow.Events()
+	<-slow.Events()
+	_, open := <-slow.Events()
+	assert.False(t, open)
+	assert.True(t, slow.Dropped())
+
+	assert.Len(t, fast.Events(), 3)
+	assert.False(t, fast.Dropped())
+	assert.Len(t, other.Events(), 0)
+	assert.Equal(t, 1, hub.Subscribers(1))
+
+	hub.Unsubscribe(fast)
+	hub.Unsubscribe(fast)
+	assert.Equal(t, 0, hub.Subscribers(1))
+}
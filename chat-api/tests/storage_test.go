@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/storage"
+)
+
+// fakeS3 замена MinIO для тестов: объекты одного бакета в памяти,
+// подпись запросов не проверяется, диапазоны отдает http.ServeContent
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// путь вида /bucket/key
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		http.Error(w, "bucket operations are not supported", http.StatusNotImplemented)
+		return
+	}
+	key := parts[1]
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+	case http.MethodGet, http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			}
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		http.ServeContent(w, r, key, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), bytes.NewReader(data))
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newFakeS3Store(bucket string) (*storage.S3, func(), error) {
+	server := httptest.NewTLSServer(&fakeS3{objects: make(map[string][]byte)})
+	client, err := minio.New(strings.TrimPrefix(server.URL, "https://"), &minio.Options{
+		Creds:        credentials.NewStaticV4("test", "test-secret", ""),
+		Secure:       true,
+		Transport:    server.Client().Transport,
+		Region:       "us-east-1",
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	return storage.NewS3(client, bucket), server.Close, nil
+}
+
+// одинаковые проверки для обоих хранилищ
+func (suite *HandlersTestSuite) TestStorage_BlobStores() {
+	t := suite.T()
+	ctx := context.Background()
+
+	s3, closeS3, err := newFakeS3Store("attachments")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer closeS3()
+	local, err := storage.NewLocal(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	stores := map[string]storage.BlobStore{"local": local, "s3": s3}
+	for name, store := range stores {
+		content := []byte("0123456789")
+		assert.NoError(t, store.Put(ctx, "chats/1/blob", bytes.NewReader(content), int64(len(content)), "text/plain"), name)
+
+		blob, err := store.Open(ctx, "chats/1/blob")
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		_, err = blob.Seek(4, io.SeekStart)
+		assert.NoError(t, err, name)
+		part := make([]byte, 3)
+		_, err = io.ReadFull(blob, part)
+		assert.NoError(t, err, name)
+		assert.Equal(t, "456", string(part), name)
+		blob.Close()
+
+		assert.NoError(t, store.Delete(ctx, "chats/1/blob"), name)
+		_, err = store.Open(ctx, "chats/1/blob")
+		assert.True(t, errors.Is(err, storage.ErrNotFound), name)
+		// повторное удаление не ошибка
+		assert.NoError(t, store.Delete(ctx, "chats/1/blob"), name)
+	}
+
+	// короткое тело не сохраняется
+	assert.Error(t, local.Put(ctx, "short", strings.NewReader("abc"), 10, "text/plain"))
+	_, err = local.Open(ctx, "short")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+
+	// ключ не выходит за каталог
+	assert.Error(t, local.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"))
+}
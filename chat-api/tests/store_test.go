@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"chat-api/internal/models"
+	"chat-api/internal/store"
+)
+
+// checkStore одни и те же проверки для любой реализации хранилища,
+// addMessage кладет сообщение в обход интерфейса
+func (suite *HandlersTestSuite) checkStore(s interface {
+	store.ChatStore
+	store.MessageStore
+}, addMessage func(*models.Message)) {
+	t := suite.T()
+	ctx := context.Background()
+
+	chat := models.Chat{Type: models.ChatGroup, Title: "Хранилище", CreatedAt: time.Now(), LastActivityAt: time.Now()}
+	err := s.CreateChat(ctx, &chat, []models.ChatMember{
+		{UserID: suite.user.ID, Role: models.RoleOwner, CreatedAt: chat.CreatedAt},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotZero(t, chat.ID)
+	assert.Equal(t, 1, chat.MemberCount)
+
+	found, err := s.Chat(ctx, chat.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Хранилище", found.Title)
+	}
+	_, err = s.Chat(ctx, chat.ID+1000)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	member, err := s.Member(ctx, chat.ID, suite.user.ID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, models.RoleOwner, member.Role)
+	}
+	_, err = s.Member(ctx, chat.ID, suite.user.ID+1000)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// одинаковое время у соседей, порядок разводит id
+	base := time.Now().Truncate(time.Second)
+	var messages []*models.Message
+	for i := 0; i < 5; i++ {
+		m := &models.Message{ChatID: chat.ID, Text: fmt.Sprintf("сообщение %d", i), CreatedAt: base.Add(time.Duration(i/2) * time.Second)}
+		addMessage(m)
+		messages = append(messages, m)
+	}
+	reply := &models.Message{ChatID: chat.ID, ParentID: &messages[0].ID, Text: "ответ", CreatedAt: base}
+	addMessage(reply)
+	messages[3].DeletedAt = gorm.DeletedAt{Time: base, Valid: true}
+	addMessage(messages[3])
+
+	timeline := store.Timeline{ChatID: chat.ID}
+	page, hasMore, err := s.Before(ctx, timeline, nil, 2)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	if assert.Len(t, page, 2) {
+		// удаленное остается в ленте заглушкой
+		assert.Equal(t, messages[3].ID, page[0].ID)
+		assert.Equal(t, messages[4].ID, page[1].ID)
+	}
+	page, hasMore, err = s.Before(ctx, timeline, messages[2], 5)
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+	assert.Len(t, page, 2)
+	page, hasMore, err = s.After(ctx, timeline, messages[1], 2)
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	if assert.Len(t, page, 2) {
+		assert.Equal(t, messages[2].ID, page[0].ID)
+	}
+
+	thread, _, err := s.Before(ctx, store.Timeline{ChatID: chat.ID, RootID: messages[0].ID}, nil, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, thread, 1) {
+		assert.Equal(t, reply.ID, thread[0].ID)
+	}
+
+	_, err = s.Message(ctx, chat.ID, messages[3].ID, false)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = s.Message(ctx, chat.ID, messages[3].ID, true)
+	assert.NoError(t, err)
+	_, err = s.Message(ctx, chat.ID+1000, messages[0].ID, true)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	// поиск только по живым сообщениям, совпадения отмечены метками, а не html
+	hits, err := s.SearchMessages(ctx, store.SearchQuery{UserID: suite.user.ID, Text: "сообщ", Limit: 10})
+	assert.NoError(t, err)
+	if assert.Len(t, hits, 4) {
+		assert.Equal(t, messages[4].ID, hits[0].Message.ID)
+		assert.Equal(t, "Хранилище", hits[0].ChatTitle)
+		assert.Equal(t, store.MarkStart+"сообщение"+store.MarkEnd+" 4", hits[0].Snippet)
+	}
+	hits, err = s.SearchMessages(ctx, store.SearchQuery{UserID: suite.user.ID + 1000, Text: "сообщ", Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, hits)
+}
+
+func (suite *HandlersTestSuite) TestStore_Gorm() {
+	suite.requireDB()
+	suite.checkStore(store.NewGormStore(testDB), func(m *models.Message) {
+		assert.NoError(suite.T(), testDB.Save(m).Error)
+	})
+}
+
+func (suite *HandlersTestSuite) TestStore_Memory() {
+	memory := store.NewMemoryStore()
+	suite.checkStore(memory, memory.AddMessage)
+}
+
+// brokenStore хранилище, у которого отвалилась база
+type brokenStore struct {
+	store.UserStore
+	store.ChatStore
+	store.MessageStore
+}
+
+var errStoreDown = errors.New("connection refused")
+
+func (brokenStore) User(ctx context.Context, id uint) (*models.User, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) Chat(ctx context.Context, id uint) (*models.Chat, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) Message(ctx context.Context, chatID, id uint, withDeleted bool) (*models.Message, error) {
+	return nil, errStoreDown
+}
+
+func (brokenStore) Before(ctx context.Context, timeline store.Timeline, pivot *models.Message, limit int) ([]models.Message, bool, error) {
+	return nil, false, errStoreDown
+}
+
+func (suite *HandlersTestSuite) TestStore_Failures() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Сбой", suite.user.ID)
+
+	// сбой хранилища не выдается за отсутствие чата
+	h := newTestHandler()
+	h.Chats = brokenStore{ChatStore: testStore}
+	rr := performAuthRequest(createRouterWith(h), "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+
+	h = newTestHandler()
+	h.Messages = brokenStore{MessageStore: testStore}
+	rr = performAuthRequest(createRouterWith(h), "GET", fmt.Sprintf("/chats/%d", chat.ID), nil, suite.token)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
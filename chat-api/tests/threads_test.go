@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/stretchr/testify/assert"
+
+	"chat-api/internal/models"
+)
+
+type threadResponse struct {
+	Root       models.Message   `json:"root"`
+	Replies    []models.Message `json:"replies"`
+	PrevCursor *uint            `json:"prev_cursor"`
+	NextCursor *uint            `json:"next_cursor"`
+}
+
+func (suite *HandlersTestSuite) postReply(chatID, parentID uint, text string) models.Message {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chatID), map[string]interface{}{
+		"text":      text,
+		"parent_id": parentID,
+	}, suite.token)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var message models.Message
+	json.Unmarshal(rr.Body.Bytes(), &message)
+	return message
+}
+
+func (suite *HandlersTestSuite) getThread(chatID, rootID uint, query string) threadResponse {
+	t := suite.T()
+
+	rr := performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/messages/%d/thread%s", chatID, rootID, query), nil, suite.token)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response threadResponse
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	return response
+}
+
+func (suite *HandlersTestSuite) TestThreads_RepliesStayOutOfTimeline() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Поддержка", suite.user.ID)
+	root := suite.postMessage(chat.ID, "Вопрос клиента", suite.token)
+	other := suite.postMessage(chat.ID, "Другой разговор", suite.token)
+	suite.postReply(chat.ID, root.ID, "Ответ 1")
+	last := suite.postReply(chat.ID, root.ID, "Ответ 2")
+	assert.Equal(t, root.ID, *last.ParentID)
+
+	page := suite.getHistory(chat.ID, "")
+	assert.Equal(t, []uint{root.ID, other.ID}, messageIDs(page.Messages))
+	assert.Equal(t, 2, page.Messages[0].ReplyCount)
+	if assert.NotNil(t, page.Messages[0].LastReplyAt) {
+		assert.WithinDuration(t, last.CreatedAt, *page.Messages[0].LastReplyAt, 0)
+	}
+	assert.Equal(t, 0, page.Messages[1].ReplyCount)
+	assert.Nil(t, page.Messages[1].LastReplyAt)
+}
+
+func (suite *HandlersTestSuite) TestThreads_Paging() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Поддержка", suite.user.ID)
+	root := suite.postMessage(chat.ID, "Вопрос", suite.token)
+	var ids []uint
+	for i := 1; i <= 5; i++ {
+		ids = append(ids, suite.postReply(chat.ID, root.ID, fmt.Sprintf("Ответ %d", i)).ID)
+	}
+
+	thread := suite.getThread(chat.ID, root.ID, "?limit=2")
+	assert.Equal(t, root.ID, thread.Root.ID)
+	assert.Equal(t, ids[3:], messageIDs(thread.Replies))
+	assert.Nil(t, thread.NextCursor)
+	if assert.NotNil(t, thread.PrevCursor) {
+		thread = suite.getThread(chat.ID, root.ID, fmt.Sprintf("?limit=2&before=%d", *thread.PrevCursor))
+		assert.Equal(t, ids[1:3], messageIDs(thread.Replies))
+	}
+
+	thread = suite.getThread(chat.ID, root.ID, fmt.Sprintf("?limit=10&after=%d", ids[0]))
+	assert.Equal(t, ids[1:], messageIDs(thread.Replies))
+	assert.Nil(t, thread.NextCursor)
+}
+
+func (suite *HandlersTestSuite) TestThreads_Validation() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Поддержка", suite.user.ID)
+	root := suite.postMessage(chat.ID, "Вопрос", suite.token)
+	reply := suite.postReply(chat.ID, root.ID, "Ответ")
+	other := createTestChat(t, "Другой", suite.user.ID)
+
+	// вложенные ветки не поддерживаются
+	rr := performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", chat.ID), map[string]interface{}{
+		"text": "Ответ на ответ", "parent_id": reply.ID,
+	}, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = performAuthRequest(suite.router, "POST", fmt.Sprintf("/chats/%d/messages", other.ID), map[string]interface{}{
+		"text": "Не тот чат", "parent_id": root.ID,
+	}, suite.token)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = performAuthRequest(suite.router, "GET", fmt.Sprintf("/chats/%d/messages/%d/thread", chat.ID, reply.ID), nil, suite.token)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func (suite *HandlersTestSuite) TestThreads_PurgeReplyAndRoot() {
+	t := suite.T()
+
+	chat := createTestChat(t, "Поддержка", suite.user.ID)
+	root := suite.postMessage(chat.ID, "Вопрос", suite.token)
+	first := suite.postReply(chat.ID, root.ID, "Ответ 1")
+	suite.postReply(chat.ID, root.ID, "Ответ 2")
+
+	rr := performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d?purge=true", chat.ID, first.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	thread := suite.getThread(chat.ID, root.ID, "")
+	assert.Equal(t, 1, thread.Root.ReplyCount)
+	assert.Len(t, thread.Replies, 1)
+
+	rr = performAuthRequest(suite.router, "DELETE", fmt.Sprintf("/chats/%d/messages/%d?purge=true", chat.ID, root.ID), nil, suite.token)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	// в ленте не осталось даже заглушек
+	lastID, err := testStore.LastMessageID(context.Background(), chat.ID)
+	assert.NoError(t, err)
+	assert.Zero(t, lastID)
+}